@@ -0,0 +1,10 @@
+// Package poker embeds the web client, so that the server binary runs from any
+// directory
+package poker
+
+import "embed"
+
+// Assets holds the static/ and templates/ directories of the web client
+//
+//go:embed static templates
+var Assets embed.FS
@@ -0,0 +1,21 @@
+// Package bus carries room messages between server instances, so that
+// players connected to different instances see the same rooms
+package bus
+
+// Handler receives a message published for a room
+type Handler func(roomID string, data []byte)
+
+// Bus publishes room messages to every subscribed instance, including the
+// publishing one. Messages published by an instance for a room are
+// delivered in order.
+type Bus interface {
+	// Publish sends a message for a room
+	Publish(roomID string, data []byte) error
+	// Subscribe registers a handler called for every message
+	Subscribe(handler Handler)
+	// OnReconnect registers a function called when the bus recovers from a
+	// disconnection, during which messages may have been lost
+	OnReconnect(fn func())
+	// Close stops delivering messages and releases resources
+	Close() error
+}
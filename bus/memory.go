@@ -0,0 +1,113 @@
+package bus
+
+import "sync"
+
+// MemoryBus is an in-process bus, connecting instances running in the same
+// process, such as in tests. A single instance needs no bus: its rooms
+// publish nothing.
+type MemoryBus struct {
+	mutex       sync.Mutex
+	subscribers []*memorySubscriber
+	closed      bool
+}
+
+// memoryMessage is a message waiting to be delivered
+type memoryMessage struct {
+	roomID string
+	data   []byte
+}
+
+// memorySubscriber delivers messages to a handler from its own goroutine, so
+// that publishers never wait for handlers
+type memorySubscriber struct {
+	handler Handler
+
+	mutex sync.Mutex
+	queue []memoryMessage
+	wake  chan struct{}
+	done  chan struct{}
+}
+
+// NewMemoryBus creates an in-process bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+// Publish queues a message for every subscriber
+func (b *MemoryBus) Publish(roomID string, data []byte) error {
+	message := memoryMessage{roomID: roomID, data: append([]byte(nil), data...)}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, subscriber := range b.subscribers {
+		subscriber.mutex.Lock()
+		subscriber.queue = append(subscriber.queue, message)
+		subscriber.mutex.Unlock()
+
+		select {
+		case subscriber.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Subscribe registers a handler called for every message published from now on
+func (b *MemoryBus) Subscribe(handler Handler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	subscriber := &memorySubscriber{
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	b.subscribers = append(b.subscribers, subscriber)
+
+	go subscriber.run()
+}
+
+// OnReconnect does nothing, since the in-process bus never disconnects
+func (b *MemoryBus) OnReconnect(fn func()) {}
+
+// Close stops delivering messages
+func (b *MemoryBus) Close() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.closed {
+		b.closed = true
+		for _, subscriber := range b.subscribers {
+			close(subscriber.done)
+		}
+		b.subscribers = nil
+	}
+
+	return nil
+}
+
+// run delivers queued messages in order until the bus is closed
+func (s *memorySubscriber) run() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+
+		s.mutex.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.mutex.Unlock()
+
+		for _, message := range queue {
+			s.handler(message.roomID, message.data)
+		}
+	}
+}
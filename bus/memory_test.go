@@ -0,0 +1,95 @@
+package bus
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// received is a message delivered to a test handler
+type received struct {
+	roomID string
+	data   string
+}
+
+// collect subscribes a handler sending the messages it receives on a channel
+func collect(b Bus) chan received {
+	messages := make(chan received, 100)
+	b.Subscribe(func(roomID string, data []byte) {
+		messages <- received{roomID: roomID, data: string(data)}
+	})
+
+	return messages
+}
+
+// next returns the next message delivered to a handler
+func next(t *testing.T, messages chan received) received {
+	t.Helper()
+
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(time.Second):
+		t.Fatal("no message delivered")
+		return received{}
+	}
+}
+
+func TestMemoryBusDeliversInOrder(t *testing.T) {
+	b := NewMemoryBus()
+	defer b.Close()
+
+	first, second := collect(b), collect(b)
+
+	for i := 0; i < 10; i++ {
+		if err := b.Publish("room", []byte(strconv.Itoa(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, messages := range []chan received{first, second} {
+		for i := 0; i < 10; i++ {
+			if message := next(t, messages); message.roomID != "room" || message.data != strconv.Itoa(i) {
+				t.Fatalf("message %d = %+v", i, message)
+			}
+		}
+	}
+}
+
+func TestMemoryBusDoesNotWaitForHandlers(t *testing.T) {
+	b := NewMemoryBus()
+	defer b.Close()
+
+	release := make(chan struct{})
+	defer close(release)
+	b.Subscribe(func(string, []byte) { <-release })
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			b.Publish("room", nil)
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow handler")
+	}
+}
+
+func TestMemoryBusClose(t *testing.T) {
+	b := NewMemoryBus()
+	messages := collect(b)
+	b.Close()
+
+	b.Publish("room", []byte("late"))
+	collect(b)
+
+	select {
+	case message := <-messages:
+		t.Errorf("message %+v delivered after Close", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
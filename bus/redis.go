@@ -0,0 +1,157 @@
+package bus
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Arvi89/poker-go/redis"
+)
+
+// channelPrefix is the prefix of the Redis channels carrying room messages
+const channelPrefix = "poker:events:"
+
+// resubscribeDelay is the wait before reconnecting a lost subscription
+const resubscribeDelay = 2 * time.Second
+
+// RedisBus is a bus using Redis publish/subscribe, connecting instances
+// running anywhere. Messages are delivered at most once: those published
+// while an instance is disconnected are lost to it, so it should resync its
+// rooms when the subscription is restored.
+type RedisBus struct {
+	client   *redis.Client
+	addr     string
+	password string
+
+	mutex        sync.Mutex
+	handlers     []Handler
+	onReconnect  func()
+	subscription *redis.Subscription
+	started      bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRedisBus creates a bus publishing with the given client and subscribing
+// with a dedicated connection to the same server
+func NewRedisBus(client *redis.Client, addr, password string) *RedisBus {
+	return &RedisBus{
+		client:   client,
+		addr:     addr,
+		password: password,
+		done:     make(chan struct{}),
+	}
+}
+
+// Publish sends a message for a room to every instance
+func (b *RedisBus) Publish(roomID string, data []byte) error {
+	_, err := b.client.Do("PUBLISH", channelPrefix+roomID, string(data))
+	return err
+}
+
+// Subscribe registers a handler called for every message. The subscription
+// is opened in the background with the first handler.
+func (b *RedisBus) Subscribe(handler Handler) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.handlers = append(b.handlers, handler)
+	if !b.started {
+		b.started = true
+		b.wg.Add(1)
+		go b.run()
+	}
+}
+
+// OnReconnect registers a function called each time a lost subscription is
+// restored, since messages published in the meantime were lost
+func (b *RedisBus) OnReconnect(fn func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.onReconnect = fn
+}
+
+// Close stops the subscription
+func (b *RedisBus) Close() error {
+	close(b.done)
+
+	b.mutex.Lock()
+	if b.subscription != nil {
+		b.subscription.Close()
+	}
+	b.mutex.Unlock()
+
+	b.wg.Wait()
+	return nil
+}
+
+// run keeps a subscription open and dispatches its messages until the bus is
+// closed
+func (b *RedisBus) run() {
+	defer b.wg.Done()
+
+	connected := false
+	for {
+		subscription, err := redis.PSubscribe(b.addr, b.password, channelPrefix+"*")
+		if err != nil {
+			slog.Error("Failed to subscribe to room messages", "error", err)
+
+			select {
+			case <-time.After(resubscribeDelay):
+				continue
+			case <-b.done:
+				return
+			}
+		}
+
+		b.mutex.Lock()
+		select {
+		case <-b.done:
+			b.mutex.Unlock()
+			subscription.Close()
+			return
+		default:
+		}
+		b.subscription = subscription
+		onReconnect := b.onReconnect
+		b.mutex.Unlock()
+
+		if connected && onReconnect != nil {
+			onReconnect()
+		}
+		connected = true
+
+		b.receive(subscription)
+
+		select {
+		case <-b.done:
+			return
+		default:
+			slog.Warn("Lost subscription to room messages, reconnecting")
+		}
+	}
+}
+
+// receive dispatches the messages of a subscription until it fails
+func (b *RedisBus) receive(subscription *redis.Subscription) {
+	defer subscription.Close()
+
+	for {
+		channel, data, err := subscription.Receive()
+		if err != nil {
+			return
+		}
+
+		b.mutex.Lock()
+		handlers := b.handlers
+		b.mutex.Unlock()
+
+		roomID := strings.TrimPrefix(channel, channelPrefix)
+		for _, handler := range handlers {
+			handler(roomID, data)
+		}
+	}
+}
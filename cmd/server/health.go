@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Arvi89/poker-go/db"
+	"github.com/Arvi89/poker-go/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// startTime is when the server started
+var startTime = time.Now()
+
+// healthz reports that the process is alive
+func healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz reports whether the server can take traffic: the store must be
+// reachable and the server must not be shutting down, so that load
+// balancers stop sending clients to it while it drains
+func readyz(store db.RoomStore, roomHandler *handlers.RoomHandler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks := gin.H{"store": "ok", "websockets": "ok"}
+		ready := true
+
+		if err := store.Ping(); err != nil {
+			checks["store"] = err.Error()
+			ready = false
+		}
+		if roomHandler.Draining() {
+			checks["websockets"] = "shutting down"
+			ready = false
+		}
+
+		if !ready {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+	}
+}
+
+// versionInfo reports the build of the running server
+func versionInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   version,
+		"commit":    commit,
+		"buildDate": buildDate,
+		"startTime": startTime,
+		"uptime":    time.Since(startTime).Round(time.Second).String(),
+	})
+}
@@ -1,80 +1,148 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
+	poker "github.com/Arvi89/poker-go"
+	"github.com/Arvi89/poker-go/config"
 	"github.com/Arvi89/poker-go/db"
 	"github.com/Arvi89/poker-go/handlers"
+	"github.com/Arvi89/poker-go/models"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	// Create a new Gin router
-	router := gin.Default()
-
-	// Configure CORS
-	config := cors.DefaultConfig()
-
-	// Read CORS settings from environment
-	corsOrigins := os.Getenv("CORS_ORIGINS")
-	if corsOrigins != "" {
-		// Split by comma and trim spaces
-		origins := strings.Split(corsOrigins, ",")
-		for i, origin := range origins {
-			origins[i] = strings.TrimSpace(origin)
-		}
-		config.AllowOrigins = origins
-		config.AllowAllOrigins = false
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fatal("Failed to load configuration", "error", err)
+	}
+
+	slog.SetDefault(cfg.Logger(os.Stderr))
+
+	// Create a new Gin router, logging requests with their ID
+	router := gin.New()
+	router.Use(handlers.RequestID(), handlers.AccessLog(), gin.Recovery())
+
+	// Configure CORS, allowing every origin unless some are configured. Only
+	// configured origins may send credentials: any site could otherwise make
+	// requests on behalf of a player through their session cookie.
+	corsConfig := cors.DefaultConfig()
+	if len(cfg.CORSOrigins) > 0 {
+		corsConfig.AllowOrigins = cfg.CORSOrigins
+		corsConfig.AllowAllOrigins = false
+		corsConfig.AllowCredentials = true
 	} else {
-		// Default origins in development
-		config.AllowAllOrigins = true
+		corsConfig.AllowAllOrigins = true
 	}
 
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
-	config.AllowCredentials = true
-	router.Use(cors.New(config))
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Session-Token"}
+	corsConfig.ExposeHeaders = []string{handlers.RequestIDHeader}
+	router.Use(cors.New(corsConfig))
+	router.Use(handlers.RequestMetrics())
 
-	// Create a new store
-	store := db.NewStore()
+	// Remove rooms left idle or open for too long, warning their clients first
+	expiry := models.Expiry{
+		IdleTTL:     cfg.Rooms.IdleTTL,
+		MaxLifetime: cfg.Rooms.MaxLifetime,
+		Warning:     cfg.Rooms.ExpiryWarning,
+	}
+
+	// Create the room store, in memory unless a durable driver is configured
+	store, err := db.NewStore(cfg.Store, expiry, cfg.Rooms.ReconnectGrace)
+	if err != nil {
+		fatal("Failed to open store", "driver", cfg.Store.Driver, "error", err)
+	}
 
 	// Create room handler
-	roomHandler := handlers.NewRoomHandler(store)
+	roomHandler := handlers.NewRoomHandler(store, cfg)
+	handlers.RegisterStoreMetrics(store)
 
-	// Set up periodic cleanup for empty rooms
+	// Set up periodic cleanup for empty and expired rooms, until shutdown
+	stopCleanup := make(chan struct{})
+	cleanupStopped := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(30 * time.Minute)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			count := store.CleanupEmptyRooms()
-			log.Printf("Cleaned up %d empty rooms", count)
+		defer close(cleanupStopped)
+
+		cleanupTicker := time.NewTicker(cfg.CleanupInterval)
+		defer cleanupTicker.Stop()
+
+		// Check expiry often enough for clients to be warned in time
+		expiryTicker := time.NewTicker(cfg.Rooms.ExpiryCheckInterval)
+		defer expiryTicker.Stop()
+
+		for {
+			select {
+			case <-cleanupTicker.C:
+				count := store.CleanupEmptyRooms()
+				slog.Info("Cleaned up empty rooms", "count", count)
+			case <-expiryTicker.C:
+				if count := store.ExpireRooms(expiry); count > 0 {
+					slog.Info("Expired rooms", "count", count)
+				}
+			case <-stopCleanup:
+				return
+			}
 		}
 	}()
 
+	// Serve the web client embedded in the binary, unless a directory is
+	// configured to work on it
+	assets, err := handlers.NewAssets(poker.Assets, cfg.AssetsDir)
+	if err != nil {
+		fatal("Failed to load web client", "error", err)
+	}
+
 	// Serve static files
-	router.Static("/static", "./static")
-	router.StaticFile("/favicon.ico", "./static/favicon.ico")
+	router.GET("/static/*filepath", assets.Static)
+	router.HEAD("/static/*filepath", assets.Static)
+	router.GET("/favicon.ico", assets.Favicon)
 
 	// Serve the main application page
-	router.LoadHTMLGlob("templates/*")
-	router.GET("/", func(c *gin.Context) {
-		c.HTML(200, "index.html", nil)
-	})
+	router.GET("/", assets.Page)
 
 	// Route for directly accessing a room
-	router.GET("/room/:id", func(c *gin.Context) {
-		c.HTML(200, "index.html", nil)
-	})
+	router.GET("/room/:id", assets.Page)
+
+	// Prometheus metrics
+	router.GET("/metrics", handlers.Metrics)
+
+	// Probes and build information for orchestrators
+	router.GET("/healthz", healthz)
+	router.GET("/readyz", readyz(store, roomHandler))
+	router.GET("/version", versionInfo)
+
+	// Operator API, only enabled with an API key
+	if cfg.Admin.APIKey != "" {
+		adminHandler := handlers.NewAdminHandler(store)
+
+		admin := router.Group("/admin", handlers.AdminAuth(cfg.Admin.APIKey))
+		{
+			admin.GET("/rooms", adminHandler.ListRooms)
+			admin.GET("/rooms/:id", adminHandler.GetRoom)
+			admin.DELETE("/rooms/:id", adminHandler.CloseRoom)
+			admin.DELETE("/rooms/:id/players/:playerId", adminHandler.KickPlayer)
+			admin.POST("/cleanup", adminHandler.CleanupRooms)
+		}
+	}
 
 	// API Routes
 	api := router.Group("/api")
 	{
 		// Room creation
 		api.POST("/rooms", roomHandler.CreateRoom)
+		api.GET("/decks", roomHandler.ListDecks)
 
 		// Room routes
 		rooms := api.Group("/rooms/:id")
@@ -85,17 +153,81 @@ func main() {
 			rooms.POST("/vote", roomHandler.SubmitVote)
 			rooms.GET("/reveal", roomHandler.RevealCards)
 			rooms.GET("/reset", roomHandler.ResetVoting)
+			rooms.POST("/estimate", roomHandler.SetEstimate)
+			rooms.POST("/timer", roomHandler.StartTimer)
+			rooms.DELETE("/timer", roomHandler.CancelTimer)
+			rooms.GET("/history", roomHandler.ExportHistory)
 			rooms.PATCH("", roomHandler.UpdateLink)
+			rooms.PATCH("/settings", roomHandler.UpdateSettings)
 			rooms.POST("/transfer-creator", roomHandler.TransferCreator)
+			rooms.PUT("/players/:playerId/role", roomHandler.SetRole)
 
-			// WebSocket endpoint for real-time updates
+			// Story backlog
+			rooms.POST("/stories", roomHandler.AddStory)
+			rooms.POST("/stories/reorder", roomHandler.ReorderStories)
+			rooms.POST("/stories/next", roomHandler.NextStory)
+			rooms.PATCH("/stories/:storyId", roomHandler.UpdateStory)
+			rooms.DELETE("/stories/:storyId", roomHandler.DeleteStory)
+
+			// WebSocket and Server-Sent Events endpoints for real-time updates
 			rooms.GET("/ws", roomHandler.WebSocketHandler)
+			rooms.GET("/events", roomHandler.EventStreamHandler)
 		}
 	}
 
 	// Start the server
-	log.Println("Starting server on :8080")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:    cfg.Addr(),
+		Handler: router,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Starting server", "version", version, "commit", commit, "addr", cfg.Addr())
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// Wait for a termination signal, then drain connections before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		fatal("Failed to start server", "error", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	slog.Info("Shutting down server")
+
+	// Report the server as not ready first, so that load balancers stop
+	// sending it clients before they are disconnected
+	roomHandler.Drain()
+	time.Sleep(cfg.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Clients reconnect once the server is back, or to another instance
+	if err := roomHandler.Shutdown(shutdownCtx, cfg.ReconnectAfter); err != nil {
+		slog.Error("Failed to close all real-time connections", "error", err)
 	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down server", "error", err)
+	}
+
+	// The store closes its rooms, nothing may remove them concurrently
+	close(stopCleanup)
+	<-cleanupStopped
+	if err := store.Close(); err != nil {
+		slog.Error("Failed to flush store", "error", err)
+	}
+
+	slog.Info("Server stopped")
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
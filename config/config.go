@@ -0,0 +1,353 @@
+// Package config loads the server settings from defaults, an optional YAML
+// file, environment variables and command-line flags, each overriding the
+// previous ones
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the server settings
+type Config struct {
+	Port            int           `yaml:"port"`
+	CORSOrigins     []string      `yaml:"cors_origins"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ReconnectAfter  time.Duration `yaml:"reconnect_after"`
+	Store           Store         `yaml:"store"`
+	Rooms           Rooms         `yaml:"rooms"`
+	WebSocket       WebSocket     `yaml:"websocket"`
+	Log             Log           `yaml:"log"`
+	Admin           Admin         `yaml:"admin"`
+	// AssetsDir is a directory holding static/ and templates/ to serve
+	// instead of the embedded web client, for development
+	AssetsDir string `yaml:"assets_dir"`
+}
+
+// Store configures the room store
+type Store struct {
+	// Driver is one of memory, file or redis
+	Driver string `yaml:"driver"`
+	// Path is the directory of the file store
+	Path string `yaml:"path"`
+	// RedisAddr and RedisPassword locate the server of the redis store
+	RedisAddr     string `yaml:"redis_addr"`
+	RedisPassword string `yaml:"redis_password"`
+}
+
+// Rooms configures the lifecycle of rooms and players
+type Rooms struct {
+	// ReconnectGrace is how long disconnected players keep their seat
+	ReconnectGrace time.Duration `yaml:"reconnect_grace"`
+	// IdleTTL and MaxLifetime limit how long rooms are kept, 0 meaning
+	// forever
+	IdleTTL     time.Duration `yaml:"idle_ttl"`
+	MaxLifetime time.Duration `yaml:"max_lifetime"`
+	// ExpiryWarning is how long before expiring clients are warned
+	ExpiryWarning time.Duration `yaml:"expiry_warning"`
+	// ExpiryCheckInterval is how often rooms are checked for expiry
+	ExpiryCheckInterval time.Duration `yaml:"expiry_check_interval"`
+}
+
+// WebSocket configures real-time connections
+type WebSocket struct {
+	ReadBufferSize  int `yaml:"read_buffer_size"`
+	WriteBufferSize int `yaml:"write_buffer_size"`
+	// PingInterval is how often idle connections are kept alive
+	PingInterval time.Duration `yaml:"ping_interval"`
+	// AllowedOrigins lists the origins allowed to connect, defaulting to the
+	// CORS origins, or else to the server's own origin
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// Log configures the server logs
+type Log struct {
+	// Level is the minimum level logged: debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is text or json
+	Format string `yaml:"format"`
+}
+
+// Admin configures the operator API
+type Admin struct {
+	// APIKey authenticates operators, the API being disabled if empty
+	APIKey string `yaml:"api_key"`
+}
+
+// setting is a value that can be set from the environment and the command line
+type setting struct {
+	flag  string
+	env   string
+	value interface{}
+	usage string
+}
+
+// Default returns the default settings
+func Default() *Config {
+	return &Config{
+		Port:            8080,
+		CleanupInterval: 30 * time.Minute,
+		ShutdownTimeout: 15 * time.Second,
+		ReconnectAfter:  5 * time.Second,
+		Store: Store{
+			Driver:    "memory",
+			Path:      "data",
+			RedisAddr: "localhost:6379",
+		},
+		Rooms: Rooms{
+			ReconnectGrace:      2 * time.Minute,
+			IdleTTL:             24 * time.Hour,
+			MaxLifetime:         7 * 24 * time.Hour,
+			ExpiryWarning:       5 * time.Minute,
+			ExpiryCheckInterval: time.Minute,
+		},
+		WebSocket: WebSocket{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			PingInterval:    15 * time.Second,
+		},
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// Load reads the settings from the command-line arguments, the environment
+// and the YAML file given by the -config flag or CONFIG_FILE, and validates
+// them
+func Load(args []string) (*Config, error) {
+	c := Default()
+
+	var path string
+	flags := flag.NewFlagSet("poker-app", flag.ContinueOnError)
+	flags.StringVar(&path, "config", os.Getenv("CONFIG_FILE"), "YAML configuration file")
+	for _, s := range c.settings() {
+		s.register(flags)
+	}
+
+	// Flags are parsed first to find the file, then again so that they
+	// override the file and the environment
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range c.settings() {
+		if err := s.loadEnv(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Validate checks that the settings are usable
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d out of range", c.Port))
+	}
+	if c.CleanupInterval <= 0 {
+		errs = append(errs, errors.New("cleanup interval must be positive"))
+	}
+	if c.ShutdownTimeout < 0 || c.ShutdownDelay < 0 {
+		errs = append(errs, errors.New("shutdown durations must not be negative"))
+	}
+	if c.ReconnectAfter <= 0 {
+		errs = append(errs, errors.New("reconnect delay must be positive"))
+	}
+
+	switch c.Store.Driver {
+	case "memory":
+	case "file":
+		if c.Store.Path == "" {
+			errs = append(errs, errors.New("file store needs a path"))
+		}
+	case "redis":
+		if c.Store.RedisAddr == "" {
+			errs = append(errs, errors.New("redis store needs an address"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown store driver %q", c.Store.Driver))
+	}
+
+	if c.Rooms.ReconnectGrace < 0 || c.Rooms.IdleTTL < 0 || c.Rooms.MaxLifetime < 0 || c.Rooms.ExpiryWarning < 0 {
+		errs = append(errs, errors.New("room durations must not be negative"))
+	}
+	if c.Rooms.ExpiryCheckInterval <= 0 {
+		errs = append(errs, errors.New("room expiry check interval must be positive"))
+	} else if c.Rooms.ExpiryWarning > 0 && c.Rooms.ExpiryCheckInterval > c.Rooms.ExpiryWarning {
+		// A room could expire between two checks without its clients being warned
+		errs = append(errs, fmt.Errorf("room expiry check interval %s must not exceed the expiry warning %s",
+			c.Rooms.ExpiryCheckInterval, c.Rooms.ExpiryWarning))
+	}
+
+	if c.WebSocket.ReadBufferSize <= 0 || c.WebSocket.WriteBufferSize <= 0 {
+		errs = append(errs, errors.New("websocket buffer sizes must be positive"))
+	}
+	if c.WebSocket.PingInterval <= 0 {
+		errs = append(errs, errors.New("websocket ping interval must be positive"))
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("unknown log level %q", c.Log.Level))
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		errs = append(errs, fmt.Errorf("unknown log format %q", c.Log.Format))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// Addr returns the address the server listens on
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// Logger returns the logger writing records to w as configured
+func (c *Config) Logger(w io.Writer) *slog.Logger {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.Log.Level))
+	options := &slog.HandlerOptions{Level: level}
+
+	if c.Log.Format == "json" {
+		return slog.New(slog.NewJSONHandler(w, options))
+	}
+
+	return slog.New(slog.NewTextHandler(w, options))
+}
+
+// settings lists the values that can be set from the environment and flags
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", &c.Port, "HTTP port to listen on"},
+		{"cors-origins", "CORS_ORIGINS", &c.CORSOrigins, "comma-separated origins allowed by CORS, all if empty"},
+		{"cleanup-interval", "CLEANUP_INTERVAL", &c.CleanupInterval, "interval between removals of empty rooms"},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", &c.ShutdownTimeout, "time given to connections to close on shutdown"},
+		{"shutdown-delay", "SHUTDOWN_DELAY", &c.ShutdownDelay, "time the server reports itself unready before shutting down"},
+		{"assets-dir", "ASSETS_DIR", &c.AssetsDir, "directory to serve static/ and templates/ from instead of the embedded ones"},
+		{"reconnect-after", "RECONNECT_AFTER", &c.ReconnectAfter, "delay after which clients reconnect when the server shuts down"},
+		{"store-driver", "STORE_DRIVER", &c.Store.Driver, "room store: memory, file or redis"},
+		{"store-path", "STORE_PATH", &c.Store.Path, "directory of the file store"},
+		{"redis-addr", "REDIS_ADDR", &c.Store.RedisAddr, "address of the redis store"},
+		{"redis-password", "REDIS_PASSWORD", &c.Store.RedisPassword, "password of the redis store"},
+		{"reconnect-grace", "RECONNECT_GRACE", &c.Rooms.ReconnectGrace, "time disconnected players keep their seat"},
+		{"room-idle-ttl", "ROOM_IDLE_TTL", &c.Rooms.IdleTTL, "time idle rooms are kept, 0 for ever"},
+		{"room-max-lifetime", "ROOM_MAX_LIFETIME", &c.Rooms.MaxLifetime, "time rooms are kept after creation, 0 for ever"},
+		{"room-expiry-warning", "ROOM_EXPIRY_WARNING", &c.Rooms.ExpiryWarning, "time before expiry clients are warned"},
+		{"room-expiry-check-interval", "ROOM_EXPIRY_CHECK_INTERVAL", &c.Rooms.ExpiryCheckInterval, "interval between checks for expired rooms"},
+		{"ws-read-buffer-size", "WS_READ_BUFFER_SIZE", &c.WebSocket.ReadBufferSize, "WebSocket read buffer size in bytes"},
+		{"ws-write-buffer-size", "WS_WRITE_BUFFER_SIZE", &c.WebSocket.WriteBufferSize, "WebSocket write buffer size in bytes"},
+		{"ws-ping-interval", "WS_PING_INTERVAL", &c.WebSocket.PingInterval, "interval between keep-alive pings"},
+		{"ws-allowed-origins", "WS_ALLOWED_ORIGINS", &c.WebSocket.AllowedOrigins, "comma-separated origins allowed to open WebSockets, the CORS origins if empty"},
+		{"log-level", "LOG_LEVEL", &c.Log.Level, "minimum level logged: debug, info, warn or error"},
+		{"log-format", "LOG_FORMAT", &c.Log.Format, "log format: text or json"},
+		{"admin-api-key", "ADMIN_API_KEY", &c.Admin.APIKey, "key authenticating the admin API, disabled if empty"},
+	}
+}
+
+// loadFile reads the settings present in a YAML file
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("decode config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// register adds the setting to a flag set
+func (s setting) register(flags *flag.FlagSet) {
+	switch value := s.value.(type) {
+	case *int:
+		flags.IntVar(value, s.flag, *value, s.usage)
+	case *string:
+		flags.StringVar(value, s.flag, *value, s.usage)
+	case *time.Duration:
+		flags.DurationVar(value, s.flag, *value, s.usage)
+	case *[]string:
+		flags.Func(s.flag, s.usage, func(text string) error {
+			*value = splitList(text)
+			return nil
+		})
+	}
+}
+
+// loadEnv reads the setting from its environment variable, if set. An empty
+// variable clears a string or a list, such as the CORS origins of the file,
+// and leaves numbers and durations unchanged.
+func (s setting) loadEnv() error {
+	text, exists := os.LookupEnv(s.env)
+	if !exists {
+		return nil
+	}
+
+	var err error
+	switch value := s.value.(type) {
+	case *int:
+		if text != "" {
+			*value, err = strconv.Atoi(text)
+		}
+	case *string:
+		*value = text
+	case *time.Duration:
+		if text != "" {
+			*value, err = time.ParseDuration(text)
+		}
+	case *[]string:
+		*value = splitList(text)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", s.env, text)
+	}
+
+	return nil
+}
+
+// splitList splits a comma-separated list, trimming spaces and dropping
+// empty items
+func splitList(text string) []string {
+	var items []string
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
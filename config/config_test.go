@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes a YAML configuration file and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+port: 9000
+cors_origins: [https://file.example.com]
+shutdown_delay: 3s
+log:
+  level: debug
+rooms:
+  idle_ttl: 2h
+`)
+
+	// The environment overrides the file, an empty variable clearing a list,
+	// and flags override both
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "9100")
+	t.Setenv("CORS_ORIGINS", "")
+	t.Setenv("ROOM_IDLE_TTL", "3h")
+	t.Setenv("SHUTDOWN_DELAY", "")
+	t.Setenv("LOG_FORMAT", "json")
+
+	c, err := Load([]string{"-port", "9200", "-log-format", "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"port from flag", c.Port, 9200},
+		{"CORS origins cleared by the environment", c.CORSOrigins, []string(nil)},
+		{"idle TTL from the environment", c.Rooms.IdleTTL, 3 * time.Hour},
+		{"shutdown delay kept from the file", c.ShutdownDelay, 3 * time.Second},
+		{"log level from the file", c.Log.Level, "debug"},
+		{"log format from flag", c.Log.Format, "text"},
+		{"ping interval by default", c.WebSocket.PingInterval, 15 * time.Second},
+	}
+
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadInvalidEnvironment(t *testing.T) {
+	t.Setenv("PORT", "eighty")
+
+	if _, err := Load(nil); err == nil {
+		t.Error("Load accepted an invalid PORT")
+	}
+}
@@ -0,0 +1,464 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Arvi89/poker-go/models"
+)
+
+// File names used by the file store
+const (
+	snapshotFile   = "snapshot.json"
+	journalFile    = "journal.jsonl"
+	oldJournalFile = "journal.jsonl.old"
+)
+
+// Journal operations
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// Snapshot settings. Every journal entry holds the full state of a room,
+// history included, so the journal is compacted by size as well as by count.
+const (
+	snapshotInterval = 5 * time.Minute
+	snapshotEvery    = 1000
+	snapshotSize     = 16 << 20
+)
+
+// journalEntry is a single line of the append-only journal
+type journalEntry struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id"`
+	Room json.RawMessage `json:"room,omitempty"`
+}
+
+// snapshot is the compacted state of all rooms
+type snapshot struct {
+	Rooms     []json.RawMessage `json:"rooms"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// FileStore is a durable store keeping rooms in memory and persisting every
+// mutation to an append-only JSON journal, compacted into periodic snapshots
+type FileStore struct {
+	mem *MemoryStore
+	dir string
+
+	journalMutex sync.Mutex
+	journal      *os.File
+	entries      int
+	size         int
+
+	compact chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewFileStore opens (or creates) a file store in the given directory
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+
+	s := &FileStore{
+		mem:     NewMemoryStore(),
+		dir:     dir,
+		compact: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	// Restored rooms journal their changes as soon as their handler is set, so
+	// the journal must be open before they are loaded
+	journal, err := os.OpenFile(s.path(journalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	s.journal = journal
+
+	if err := s.load(); err != nil {
+		s.mem.closeAll()
+		s.journal.Close()
+		return nil, err
+	}
+
+	// Start from a clean snapshot so the journal only holds new mutations
+	if err := s.snapshot(); err != nil {
+		s.mem.closeAll()
+		s.journal.Close()
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+// CreateRoom creates a new room with the given creator name and deck
+func (s *FileStore) CreateRoom(creatorName string, deck models.Deck) *models.Room {
+	room := s.mem.CreateRoom(creatorName, deck)
+	room.SetChangeHandler(s.save)
+
+	data, err := room.State()
+	if err != nil {
+		slog.Error("Failed to serialize room", "room", room.ID, "error", err)
+		return room
+	}
+
+	s.save(room.ID, data)
+
+	return room
+}
+
+// GetRoom returns a room by ID
+func (s *FileStore) GetRoom(roomID string) (*models.Room, bool) {
+	return s.mem.GetRoom(roomID)
+}
+
+// Rooms returns all stored rooms
+func (s *FileStore) Rooms() []*models.Room {
+	return s.mem.list()
+}
+
+// DeleteRoom removes a room from the store
+func (s *FileStore) DeleteRoom(roomID string) bool {
+	if !s.mem.DeleteRoom(roomID) {
+		return false
+	}
+
+	s.append(journalEntry{Op: opDelete, ID: roomID})
+	return true
+}
+
+// CleanupEmptyRooms removes rooms that have no players
+func (s *FileStore) CleanupEmptyRooms() int {
+	removed := s.mem.cleanupEmptyRooms()
+	for _, id := range removed {
+		s.append(journalEntry{Op: opDelete, ID: id})
+	}
+
+	return len(removed)
+}
+
+// ExpireRooms removes rooms that have been idle or open for too long
+func (s *FileStore) ExpireRooms(expiry models.Expiry) int {
+	expired := s.mem.expireRooms(expiry)
+	for _, id := range expired {
+		s.append(journalEntry{Op: opDelete, ID: id})
+	}
+
+	return len(expired)
+}
+
+// Ping checks that the store directory is still available
+func (s *FileStore) Ping() error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+
+	return nil
+}
+
+// Close writes a final snapshot, closes the rooms and then the journal.
+// Changes made by room timers between the snapshot and the rooms stopping are
+// still journaled.
+func (s *FileStore) Close() error {
+	close(s.done)
+	s.wg.Wait()
+
+	err := s.snapshot()
+	s.mem.closeAll()
+
+	s.journalMutex.Lock()
+	defer s.journalMutex.Unlock()
+
+	if closeErr := s.journal.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// save journals the serialized state of a room. It is installed as the room's
+// change handler and therefore runs on the room's goroutine.
+func (s *FileStore) save(roomID string, data []byte) {
+	s.append(journalEntry{Op: opPut, ID: roomID, Room: data})
+}
+
+// append writes an entry to the journal
+func (s *FileStore) append(entry journalEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Failed to encode journal entry", "room", entry.ID, "error", err)
+		return
+	}
+
+	s.journalMutex.Lock()
+	defer s.journalMutex.Unlock()
+
+	if _, err := s.journal.Write(append(line, '\n')); err != nil {
+		slog.Error("Failed to write journal entry", "room", entry.ID, "error", err)
+		return
+	}
+	if err := s.journal.Sync(); err != nil {
+		slog.Error("Failed to sync journal", "room", entry.ID, "error", err)
+	}
+
+	s.entries++
+	s.size += len(line) + 1
+	if s.entries >= snapshotEvery || s.size >= snapshotSize {
+		// Compaction must not run here: the caller may be running on a room's
+		// goroutine, and snapshot waits for every room through room.State()
+		select {
+		case s.compact <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run periodically compacts the journal into a snapshot
+func (s *FileStore) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.compact:
+		case <-s.done:
+			return
+		}
+
+		if err := s.snapshot(); err != nil {
+			slog.Error("Failed to write snapshot", "error", err)
+		}
+	}
+}
+
+// snapshot writes the state of all rooms and discards the journaled mutations
+// it covers. Since every journal entry holds the full state of a room,
+// replaying entries written after the journal swap on top of the snapshot
+// always yields the latest state.
+func (s *FileStore) snapshot() error {
+	if err := s.rotate(); err != nil {
+		return err
+	}
+
+	snap := snapshot{
+		Rooms:     make([]json.RawMessage, 0),
+		CreatedAt: time.Now(),
+	}
+	for _, room := range s.mem.list() {
+		data, err := room.State()
+		if errors.Is(err, models.ErrRoomNotFound) {
+			// Deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("serialize room %s: %w", room.ID, err)
+		}
+		snap.Rooms = append(snap.Rooms, data)
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode snapshot: %w", err)
+	}
+
+	tmp := s.path(snapshotFile + ".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, s.path(snapshotFile)); err != nil {
+		return fmt.Errorf("replace snapshot: %w", err)
+	}
+
+	// The old journal may only go once the new snapshot is known to be on disk
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("sync store directory: %w", err)
+	}
+	if err := os.Remove(s.path(oldJournalFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove old journal: %w", err)
+	}
+
+	return nil
+}
+
+// rotate swaps in a fresh journal so new mutations are kept until the
+// snapshot is written. A journal left over by a failed snapshot is not
+// covered by any snapshot yet and would be overwritten, so the current
+// journal is kept instead: the next snapshot covers both, and replaying
+// older entries before the newer ones is harmless.
+func (s *FileStore) rotate() error {
+	s.journalMutex.Lock()
+	defer s.journalMutex.Unlock()
+
+	_, err := os.Stat(s.path(oldJournalFile))
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("check old journal: %w", err)
+	}
+
+	if err := s.journal.Close(); err != nil {
+		return fmt.Errorf("close journal: %w", err)
+	}
+	renameErr := os.Rename(s.path(journalFile), s.path(oldJournalFile))
+
+	// Reopen the journal even if it could not be renamed, so that mutations
+	// are still recorded
+	journal, err := os.OpenFile(s.path(journalFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	s.journal = journal
+	if renameErr != nil {
+		return fmt.Errorf("rotate journal: %w", renameErr)
+	}
+	s.entries = 0
+	s.size = 0
+
+	return nil
+}
+
+// load restores rooms from the snapshot and replays the journals
+func (s *FileStore) load() error {
+	states := make(map[string]json.RawMessage)
+
+	data, err := os.ReadFile(s.path(snapshotFile))
+	switch {
+	case err == nil:
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("decode snapshot: %w", err)
+		}
+		for _, raw := range snap.Rooms {
+			var header struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(raw, &header); err != nil {
+				return fmt.Errorf("decode snapshot room: %w", err)
+			}
+			states[header.ID] = raw
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+
+	for _, name := range []string{oldJournalFile, journalFile} {
+		if err := s.replay(s.path(name), states); err != nil {
+			return err
+		}
+	}
+
+	for id, raw := range states {
+		room, err := models.RestoreRoom(raw)
+		if err != nil {
+			return fmt.Errorf("restore room %s: %w", id, err)
+		}
+		room.SetChangeHandler(s.save)
+		s.mem.add(room)
+	}
+
+	if len(states) > 0 {
+		slog.Info("Restored rooms", "count", len(states), "dir", s.dir)
+	}
+
+	return nil
+}
+
+// replay applies the entries of a journal file to the given room states
+func (s *FileStore) replay(path string, states map[string]json.RawMessage) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry journalEntry
+			if decodeErr := json.Unmarshal(line, &entry); decodeErr != nil {
+				// A torn write at the end of the journal is expected after a crash
+				if err == io.EOF {
+					slog.Warn("Ignoring truncated journal entry", "path", path)
+					return nil
+				}
+				return fmt.Errorf("decode journal entry: %w", decodeErr)
+			}
+
+			switch entry.Op {
+			case opPut:
+				states[entry.ID] = entry.Room
+			case opDelete:
+				delete(states, entry.ID)
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read journal: %w", err)
+		}
+	}
+}
+
+// writeFileSync writes data to a file and flushes it to disk
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// syncDir flushes the entries of a directory to disk, making renames and
+// removals in it durable
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+// path returns the full path of a file in the store directory
+func (s *FileStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
@@ -0,0 +1,246 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Arvi89/poker-go/models"
+)
+
+// roomState returns the serialized state of a room with the given link, used
+// to tell its versions apart
+func roomState(id, link string) json.RawMessage {
+	return json.RawMessage(`{"id":"` + id + `","players":{},"status":"voting","link":"` + link + `"}`)
+}
+
+// putEntry returns a journal line storing a room
+func putEntry(id, link string) string {
+	line, _ := json.Marshal(journalEntry{Op: opPut, ID: id, Room: roomState(id, link)})
+	return string(line) + "\n"
+}
+
+// deleteEntry returns a journal line deleting a room
+func deleteEntry(id string) string {
+	line, _ := json.Marshal(journalEntry{Op: opDelete, ID: id})
+	return string(line) + "\n"
+}
+
+// writeFile writes a file of the store directory
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeSnapshot writes a snapshot holding the given room states
+func writeSnapshot(t *testing.T, dir string, rooms ...json.RawMessage) {
+	t.Helper()
+
+	data, err := json.Marshal(snapshot{Rooms: rooms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dir, snapshotFile, string(data))
+}
+
+// openStore opens a file store, closing it at the end of the test
+func openStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// links returns the link of each room of the store, by room ID
+func links(store *FileStore) map[string]string {
+	links := make(map[string]string)
+	for _, room := range store.Rooms() {
+		links[room.ID] = room.Snapshot().Link
+	}
+
+	return links
+}
+
+// assertLinks checks the rooms of the store and their links
+func assertLinks(t *testing.T, store *FileStore, want map[string]string) {
+	t.Helper()
+
+	got := links(store)
+	if len(got) != len(want) {
+		t.Fatalf("rooms = %v, want %v", got, want)
+	}
+	for id, link := range want {
+		if got[id] != link {
+			t.Errorf("room %s link = %q, want %q", id, got[id], link)
+		}
+	}
+}
+
+func TestFileStoreLoadsSnapshotAndJournals(t *testing.T) {
+	dir := t.TempDir()
+
+	writeSnapshot(t, dir, roomState("a", "a1"), roomState("b", "b1"))
+	writeFile(t, dir, oldJournalFile, putEntry("a", "a2")+putEntry("c", "c1"))
+	writeFile(t, dir, journalFile, putEntry("c", "c2")+putEntry("d", "d1"))
+
+	store := openStore(t, dir)
+
+	assertLinks(t, store, map[string]string{"a": "a2", "b": "b1", "c": "c2", "d": "d1"})
+}
+
+func TestFileStoreReplaysDeletions(t *testing.T) {
+	dir := t.TempDir()
+
+	writeSnapshot(t, dir, roomState("a", "a1"), roomState("b", "b1"))
+	writeFile(t, dir, oldJournalFile, deleteEntry("a")+putEntry("c", "c1"))
+	writeFile(t, dir, journalFile, deleteEntry("c")+putEntry("a", "a2")+deleteEntry("missing"))
+
+	store := openStore(t, dir)
+
+	assertLinks(t, store, map[string]string{"a": "a2", "b": "b1"})
+}
+
+func TestFileStoreIgnoresTornLastLine(t *testing.T) {
+	dir := t.TempDir()
+
+	torn := putEntry("b", "b1")
+	writeFile(t, dir, journalFile, putEntry("a", "a1")+torn[:len(torn)/2])
+
+	store := openStore(t, dir)
+
+	assertLinks(t, store, map[string]string{"a": "a1"})
+}
+
+func TestFileStoreRejectsCorruptJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, dir, journalFile, putEntry("a", "a1")+"not json\n"+putEntry("b", "b1"))
+
+	if _, err := NewFileStore(dir); err == nil {
+		t.Fatal("NewFileStore succeeded with a corrupt journal entry")
+	}
+}
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := store.CreateRoom("alice", models.DefaultDeck())
+	deleted := store.CreateRoom("bob", models.DefaultDeck())
+
+	if _, err := kept.AddPlayer("carol", "voter"); err != nil {
+		t.Fatal(err)
+	}
+	store.DeleteRoom(deleted.ID)
+
+	// Simulate a crash: the journal is left as is, without a final snapshot
+	store.journal.Close()
+	close(store.done)
+	store.wg.Wait()
+
+	restored := openStore(t, dir)
+
+	rooms := restored.Rooms()
+	if len(rooms) != 1 || rooms[0].ID != kept.ID {
+		t.Fatalf("restored rooms = %v, want only %s", links(restored), kept.ID)
+	}
+
+	var names []string
+	for _, player := range rooms[0].Snapshot().Players {
+		names = append(names, player.Name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, ",") != "alice,carol" {
+		t.Errorf("players = %v, want alice and carol", names)
+	}
+}
+
+func TestFileStoreKeepsLeftoverJournalOnRotation(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+
+	// A previous snapshot failed after rotating the journal
+	leftover := putEntry("a", "a1")
+	writeFile(t, dir, oldJournalFile, leftover)
+	store.append(journalEntry{Op: opPut, ID: "b", Room: roomState("b", "b1")})
+
+	if err := store.rotate(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, oldJournalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != leftover {
+		t.Errorf("old journal = %q, want it untouched", data)
+	}
+
+	// New mutations are still journaled, after the kept ones
+	store.append(journalEntry{Op: opPut, ID: "c", Room: roomState("c", "c1")})
+
+	data, err = os.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != putEntry("b", "b1")+putEntry("c", "c1") {
+		t.Errorf("journal = %q, want both entries", data)
+	}
+}
+
+func TestFileStoreCompactsLargeJournal(t *testing.T) {
+	dir := t.TempDir()
+	store := openStore(t, dir)
+
+	// A single entry as large as a room with a long history
+	link := strings.Repeat("x", snapshotSize)
+	store.append(journalEntry{Op: opPut, ID: "a", Room: roomState("a", link)})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := os.Stat(filepath.Join(dir, journalFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("journal of %d bytes not compacted", info.Size())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileStoreCloseStopsRooms(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	room := store.CreateRoom("alice", models.DefaultDeck())
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case <-room.Stopped():
+	default:
+		t.Error("room still running after Close")
+	}
+}
@@ -0,0 +1,334 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Arvi89/poker-go/bus"
+	"github.com/Arvi89/poker-go/models"
+	"github.com/Arvi89/poker-go/redis"
+	"github.com/google/uuid"
+)
+
+// roomKeyPrefix is the prefix of the Redis keys holding room states
+const roomKeyPrefix = "poker:room:"
+
+// roomKeyMargin is how long room keys outlive the expiry of their room, so
+// that rooms held by an instance are expired by it, warning their clients,
+// rather than dropped by Redis
+const roomKeyMargin = time.Hour
+
+// commitScript stores a room state if the stored one still has the version and
+// author the changes were made on, given as arguments with the new state and
+// the time to live of the key in milliseconds, 0 for ever. Otherwise it
+// returns the stored state, or nothing if the room was deleted.
+const commitScript = `
+local stored = redis.call('GET', KEYS[1])
+if not stored then
+	return {0}
+end
+
+local room = cjson.decode(stored)
+local author = room.author
+if type(author) ~= 'string' then
+	author = ''
+end
+if room.version ~= tonumber(ARGV[1]) or author ~= ARGV[2] then
+	return {0, stored}
+end
+
+if ARGV[4] == '0' then
+	redis.call('SET', KEYS[1], ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[3], 'PX', ARGV[4])
+end
+return {1}
+`
+
+// RedisStore is a store shared by several instances. Room states are kept in
+// Redis, and each instance holds a replica of the rooms its clients use, kept
+// up to date through the event bus. Changes are committed with a
+// compare-and-set on the version of the room, so that a command running on a
+// stale replica runs again on the stored state instead of overwriting the
+// changes of another instance. Room keys expire once their room has been
+// idle for too long or reached its maximum lifetime, so that rooms no
+// instance holds anymore do not stay in Redis for ever.
+type RedisStore struct {
+	mem            *MemoryStore
+	client         *redis.Client
+	bus            bus.Bus
+	instance       string
+	expiry         models.Expiry
+	reconnectGrace time.Duration
+
+	// loadMutex serializes the loading of replicas, so that messages
+	// received meanwhile are applied once the replica exists
+	loadMutex sync.Mutex
+}
+
+// NewRedisStore creates a store keeping rooms in Redis until they expire and
+// sharing their changes with the other instances through the bus. Players
+// found away in a room loaded from Redis are removed unless they reconnect
+// within the grace period.
+func NewRedisStore(client *redis.Client, eventBus bus.Bus, expiry models.Expiry, reconnectGrace time.Duration) *RedisStore {
+	s := &RedisStore{
+		mem:            NewMemoryStore(),
+		client:         client,
+		bus:            eventBus,
+		instance:       uuid.New().String(),
+		expiry:         expiry,
+		reconnectGrace: reconnectGrace,
+	}
+
+	eventBus.Subscribe(s.receive)
+	eventBus.OnReconnect(s.resync)
+
+	return s
+}
+
+// CreateRoom creates a new room with the given creator name and deck
+func (s *RedisStore) CreateRoom(creatorName string, deck models.Deck) *models.Room {
+	room := s.mem.CreateRoom(creatorName, deck)
+	s.attach(room)
+
+	data, err := room.State()
+	if err != nil {
+		slog.Error("Failed to serialize room", "room", room.ID, "error", err)
+		return room
+	}
+
+	args := []string{"SET", roomKeyPrefix + room.ID, string(data), "NX"}
+	if ttl := keyTTL(s.expiry, room.Snapshot().CreatedAt, time.Now()); ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := s.client.Do(args...); err != nil {
+		slog.Error("Failed to save room", "room", room.ID, "error", err)
+	}
+
+	return room
+}
+
+// GetRoom returns a room by ID, loading it from Redis if this instance has no
+// replica of it yet
+func (s *RedisStore) GetRoom(roomID string) (*models.Room, bool) {
+	if room, exists := s.mem.GetRoom(roomID); exists {
+		return room, true
+	}
+
+	s.loadMutex.Lock()
+	defer s.loadMutex.Unlock()
+
+	if room, exists := s.mem.GetRoom(roomID); exists {
+		return room, true
+	}
+
+	data, err := s.load(roomID)
+	if err != nil {
+		slog.Error("Failed to load room", "room", roomID, "error", err)
+		return nil, false
+	}
+	if data == nil {
+		return nil, false
+	}
+
+	room, err := models.RestoreReplica(data)
+	if err != nil {
+		slog.Error("Failed to restore room", "room", roomID, "error", err)
+		return nil, false
+	}
+	s.attach(room)
+	s.mem.add(room)
+
+	// The instance the away players left may be gone, along with its timers
+	room.ScheduleRemovals(s.reconnectGrace)
+
+	return room, true
+}
+
+// Rooms returns the rooms this instance holds a replica of
+func (s *RedisStore) Rooms() []*models.Room {
+	return s.mem.list()
+}
+
+// DeleteRoom removes a room from the store and from every instance
+func (s *RedisStore) DeleteRoom(roomID string) bool {
+	_, exists := s.GetRoom(roomID)
+	if exists {
+		s.mem.DeleteRoom(roomID)
+		s.forget([]string{roomID})
+	}
+
+	return exists
+}
+
+// CleanupEmptyRooms removes the rooms of this instance that have no players
+func (s *RedisStore) CleanupEmptyRooms() int {
+	removed := s.mem.cleanupEmptyRooms()
+	s.forget(removed)
+
+	return len(removed)
+}
+
+// ExpireRooms removes the rooms of this instance that have been idle or open
+// for too long
+func (s *RedisStore) ExpireRooms(expiry models.Expiry) int {
+	expired := s.mem.expireRooms(expiry)
+	s.forget(expired)
+
+	return len(expired)
+}
+
+// Ping checks that Redis answers
+func (s *RedisStore) Ping() error {
+	_, err := s.client.Do("PING")
+	return err
+}
+
+// Close stops receiving changes from the other instances, closes the rooms
+// and then the connection to Redis, so that no room commits through a closed
+// client
+func (s *RedisStore) Close() error {
+	err := s.bus.Close()
+	s.mem.closeAll()
+	if closeErr := s.client.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// attach commits the changes of a room to Redis and shares them with the
+// other instances
+func (s *RedisStore) attach(room *models.Room) {
+	createdAt := room.Snapshot().CreatedAt
+	room.SetCommitHandler(func(roomID string, baseVersion uint64, baseAuthor string, data []byte) ([]byte, bool, error) {
+		return s.commit(roomID, createdAt, baseVersion, baseAuthor, data)
+	})
+	room.SetPublisher(s.instance, s.bus)
+}
+
+// commit stores the serialized state of a room created at the given time
+// unless another instance changed it since the given version, in which case
+// the stored state is returned. Every commit postpones the expiry of the key,
+// up to the end of the room's lifetime. It is called by the commit handler
+// installed by attach and therefore runs on the room's goroutine.
+func (s *RedisStore) commit(roomID string, createdAt time.Time, baseVersion uint64, baseAuthor string, data []byte) ([]byte, bool, error) {
+	ttl := keyTTL(s.expiry, createdAt, time.Now())
+	reply, err := s.client.Do("EVAL", commitScript, "1", roomKeyPrefix+roomID,
+		strconv.FormatUint(baseVersion, 10), baseAuthor, string(data),
+		strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return nil, false, err
+	}
+
+	result, ok := reply.([]interface{})
+	if !ok || len(result) == 0 {
+		return nil, false, fmt.Errorf("unexpected reply %v", reply)
+	}
+	if committed, _ := result[0].(int64); committed == 1 {
+		return nil, true, nil
+	}
+	if len(result) == 1 {
+		// Deleted by another instance
+		return nil, false, nil
+	}
+
+	stored, ok := result[1].([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected reply %v", reply)
+	}
+
+	return stored, false, nil
+}
+
+// forget deletes rooms removed from this instance from Redis and from the
+// other instances
+func (s *RedisStore) forget(roomIDs []string) {
+	for _, id := range roomIDs {
+		if _, err := s.client.Do("DEL", roomKeyPrefix+id); err != nil {
+			slog.Error("Failed to delete room", "room", id, "error", err)
+		}
+		if err := s.bus.Publish(id, models.DeletedMessage(s.instance)); err != nil {
+			slog.Error("Failed to publish deletion of room", "room", id, "error", err)
+		}
+	}
+}
+
+// load returns the serialized state of a room, or nil if it does not exist
+func (s *RedisStore) load(roomID string) ([]byte, error) {
+	reply, err := s.client.Do("GET", roomKeyPrefix+roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch data := reply.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %T", reply)
+	}
+}
+
+// receive applies a message published by another instance to the local
+// replica of its room, if any
+func (s *RedisStore) receive(roomID string, data []byte) {
+	room, exists := s.mem.GetRoom(roomID)
+	if !exists {
+		// Wait for a replica being loaded, which may predate the message
+		s.loadMutex.Lock()
+		room, exists = s.mem.GetRoom(roomID)
+		s.loadMutex.Unlock()
+
+		if !exists {
+			return
+		}
+	}
+
+	if !room.ApplyRemote(data) {
+		s.mem.remove(roomID, room)
+	}
+}
+
+// resync reloads the replicas of this instance from Redis, after messages may
+// have been lost
+func (s *RedisStore) resync() {
+	for _, room := range s.mem.list() {
+		data, err := s.load(room.ID)
+		if err != nil {
+			slog.Error("Failed to resync room", "room", room.ID, "error", err)
+			continue
+		}
+
+		if data == nil {
+			// Deleted by another instance
+			s.mem.remove(room.ID, room)
+			continue
+		}
+
+		room.Resync(data)
+	}
+}
+
+// keyTTL returns how long the key of a room created at the given time is kept
+// after a change made now: until the room has been idle for too long or
+// reaches the end of its lifetime, whichever comes first, 0 meaning for ever
+func keyTTL(expiry models.Expiry, createdAt, now time.Time) time.Duration {
+	if expiry.IdleTTL == 0 && expiry.MaxLifetime == 0 {
+		return 0
+	}
+
+	ttl := expiry.IdleTTL
+	if expiry.MaxLifetime > 0 {
+		remaining := max(createdAt.Add(expiry.MaxLifetime).Sub(now), 0)
+		if ttl == 0 || remaining < ttl {
+			ttl = remaining
+		}
+	}
+
+	return ttl + roomKeyMargin
+}
@@ -0,0 +1,288 @@
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Arvi89/poker-go/bus"
+	"github.com/Arvi89/poker-go/models"
+	"github.com/Arvi89/poker-go/redis"
+)
+
+func TestKeyTTL(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		expiry    models.Expiry
+		createdAt time.Time
+		want      time.Duration
+	}{
+		{"no limit", models.Expiry{}, now, 0},
+		{"idle only", models.Expiry{IdleTTL: 2 * time.Hour}, now.Add(-100 * time.Hour), 2*time.Hour + roomKeyMargin},
+		{"lifetime only", models.Expiry{MaxLifetime: 48 * time.Hour}, now, 48*time.Hour + roomKeyMargin},
+		{"lifetime partly used", models.Expiry{MaxLifetime: 48 * time.Hour}, now.Add(-40 * time.Hour), 8*time.Hour + roomKeyMargin},
+		{"lifetime over", models.Expiry{MaxLifetime: 48 * time.Hour}, now.Add(-50 * time.Hour), roomKeyMargin},
+		{"idle shorter", models.Expiry{IdleTTL: 24 * time.Hour, MaxLifetime: 168 * time.Hour}, now, 24*time.Hour + roomKeyMargin},
+		{"lifetime shorter", models.Expiry{IdleTTL: 24 * time.Hour, MaxLifetime: 12 * time.Hour}, now, 12*time.Hour + roomKeyMargin},
+		{"lifetime ending first", models.Expiry{IdleTTL: 24 * time.Hour, MaxLifetime: 168 * time.Hour}, now.Add(-160 * time.Hour), 8*time.Hour + roomKeyMargin},
+	}
+
+	for _, test := range tests {
+		if got := keyTTL(test.expiry, test.createdAt, now); got != test.want {
+			t.Errorf("%s: keyTTL = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+// fakeRedis is a local server speaking RESP, keeping string keys with their
+// expiry. It understands the commands of the store, running the commit script
+// as a compare-and-set on the version of the room.
+type fakeRedis struct {
+	listener net.Listener
+
+	mutex   sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+// newFakeRedis starts a fake Redis server, stopped at the end of the test
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{
+		listener: listener,
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+	}
+	go f.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return f
+}
+
+// serve answers the commands of each connection until the server is closed
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+
+			for {
+				args, err := readCommand(reader)
+				if err != nil {
+					return
+				}
+				if _, err := conn.Write([]byte(f.run(args))); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "$")))
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+
+	return args, nil
+}
+
+// run executes a command and returns its raw reply
+func (f *fakeRedis) run(args []string) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "SET":
+		key := args[1]
+		if len(args) > 3 && args[3] == "NX" {
+			if _, exists := f.values[key]; exists {
+				return "$-1\r\n"
+			}
+		}
+		f.set(key, args[2], args[len(args)-2:])
+		return "+OK\r\n"
+	case "EVAL":
+		// The commit script: compare the stored version, then store the
+		// state with its time to live
+		key, version, author, data, ttl := args[3], args[4], args[5], args[6], args[7]
+		stored, exists := f.values[key]
+		if !exists {
+			return "*1\r\n:0\r\n"
+		}
+
+		var room struct {
+			Version uint64 `json:"version"`
+			Author  string `json:"author"`
+		}
+		json.Unmarshal([]byte(stored), &room)
+		if strconv.FormatUint(room.Version, 10) != version || room.Author != author {
+			return fmt.Sprintf("*2\r\n:0\r\n$%d\r\n%s\r\n", len(stored), stored)
+		}
+		f.set(key, data, []string{"PX", ttl})
+		return "*1\r\n:1\r\n"
+	case "PEXPIRE":
+		ms, _ := strconv.Atoi(args[2])
+		f.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	case "PTTL":
+		expires, exists := f.expires[args[1]]
+		if !exists {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(expires).Milliseconds())
+	case "GET":
+		value, exists := f.values[args[1]]
+		if !exists {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// set stores a value, with the time to live given by trailing PX arguments
+func (f *fakeRedis) set(key, value string, options []string) {
+	f.values[key] = value
+	delete(f.expires, key)
+
+	if options[0] == "PX" && options[1] != "0" {
+		ms, _ := strconv.Atoi(options[1])
+		f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+	}
+}
+
+// pttl returns the time to live of the key of a room
+func pttl(t *testing.T, client *redis.Client, roomID string) time.Duration {
+	t.Helper()
+
+	reply, err := client.Do("PTTL", roomKeyPrefix+roomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, _ := reply.(int64)
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+func TestRedisStoreSetsAndRefreshesKeyTTL(t *testing.T) {
+	expiry := models.Expiry{IdleTTL: 2 * time.Hour, MaxLifetime: 24 * time.Hour}
+	store := openRedisStore(t, newFakeRedis(t), expiry, time.Minute)
+	client := store.client
+
+	room := store.CreateRoom("alice", models.DefaultDeck())
+
+	want := expiry.IdleTTL + roomKeyMargin
+	assertTTL := func(when string) {
+		t.Helper()
+
+		if ttl := pttl(t, client, room.ID); ttl <= want-time.Minute || ttl > want {
+			t.Errorf("%s: TTL = %s, want %s", when, ttl, want)
+		}
+	}
+
+	assertTTL("after creation")
+
+	// A change postpones the expiry again
+	if _, err := client.Do("PEXPIRE", roomKeyPrefix+room.ID, "1000"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := room.AddPlayer("bob", models.RoleVoter); err != nil {
+		t.Fatal(err)
+	}
+	assertTTL("after a change")
+}
+
+// openRedisStore opens a store on the fake server, closed at the end of the
+// test
+func openRedisStore(t *testing.T, server *fakeRedis, expiry models.Expiry, reconnectGrace time.Duration) *RedisStore {
+	t.Helper()
+
+	client, err := redis.Dial(server.listener.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewRedisStore(client, bus.NewMemoryBus(), expiry, reconnectGrace)
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestRedisStoreRemovesAwayPlayersOfLoadedRooms(t *testing.T) {
+	server := newFakeRedis(t)
+
+	// bob leaves an instance that stops before his grace period is over
+	first := openRedisStore(t, server, models.Expiry{}, time.Hour)
+	room := first.CreateRoom("alice", models.DefaultDeck())
+	bobID, err := room.AddPlayer("bob", models.RoleVoter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := room.Connect(bobID); err != nil {
+		t.Fatal(err)
+	}
+	room.Disconnect(bobID, time.Hour)
+	first.Close()
+
+	second := openRedisStore(t, server, models.Expiry{}, 0)
+	replica, exists := second.GetRoom(room.ID)
+	if !exists {
+		t.Fatal("room not loaded")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, present := replica.Snapshot().Players[bobID]; !present {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("away player still in the loaded room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,37 +1,89 @@
 package db
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/Arvi89/poker-go/bus"
+	"github.com/Arvi89/poker-go/config"
+	"github.com/Arvi89/poker-go/metrics"
 	"github.com/Arvi89/poker-go/models"
+	"github.com/Arvi89/poker-go/redis"
 )
 
-// Store is a simple in-memory store for rooms
-type Store struct {
+// Available store drivers
+const (
+	DriverMemory = "memory"
+	DriverFile   = "file"
+	DriverRedis  = "redis"
+)
+
+// RoomStore is the storage backend for rooms
+type RoomStore interface {
+	// CreateRoom creates a new room with the given creator name and deck
+	CreateRoom(creatorName string, deck models.Deck) *models.Room
+	// GetRoom returns a room by ID
+	GetRoom(roomID string) (*models.Room, bool)
+	// Rooms returns the rooms held by this instance
+	Rooms() []*models.Room
+	// DeleteRoom removes a room from the store
+	DeleteRoom(roomID string) bool
+	// CleanupEmptyRooms removes rooms that have no players
+	CleanupEmptyRooms() int
+	// ExpireRooms removes rooms that have been idle or open for too long
+	ExpireRooms(expiry models.Expiry) int
+	// Ping checks that the storage backend is reachable
+	Ping() error
+	// Close flushes any pending state and releases resources
+	Close() error
+}
+
+// NewStore creates a room store using the configured driver. Stores shared
+// with other instances keep rooms until they expire, and remove the players
+// who left an instance that stopped once the reconnection grace period is
+// over.
+func NewStore(cfg config.Store, expiry models.Expiry, reconnectGrace time.Duration) (RoomStore, error) {
+	switch cfg.Driver {
+	case "", DriverMemory:
+		return NewMemoryStore(), nil
+	case DriverFile:
+		return NewFileStore(cfg.Path)
+	case DriverRedis:
+		client, err := redis.Dial(cfg.RedisAddr, cfg.RedisPassword)
+		if err != nil {
+			return nil, fmt.Errorf("connect to redis: %w", err)
+		}
+		eventBus := bus.NewRedisBus(client, cfg.RedisAddr, cfg.RedisPassword)
+		return NewRedisStore(client, eventBus, expiry, reconnectGrace), nil
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", cfg.Driver)
+	}
+}
+
+// MemoryStore is a simple in-memory store for rooms
+type MemoryStore struct {
 	rooms map[string]*models.Room
 	mutex sync.RWMutex
 }
 
-// NewStore creates a new in-memory store
-func NewStore() *Store {
-	return &Store{
+// NewMemoryStore creates a new in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
 		rooms: make(map[string]*models.Room),
 	}
 }
 
-// CreateRoom creates a new room with the given creator name
-func (s *Store) CreateRoom(creatorName string) *models.Room {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	room := models.NewRoom(creatorName)
-	s.rooms[room.ID] = room
+// CreateRoom creates a new room with the given creator name and deck
+func (s *MemoryStore) CreateRoom(creatorName string, deck models.Deck) *models.Room {
+	room := models.NewRoom(creatorName, deck)
+	s.add(room)
 
 	return room
 }
 
 // GetRoom returns a room by ID
-func (s *Store) GetRoom(roomID string) (*models.Room, bool) {
+func (s *MemoryStore) GetRoom(roomID string) (*models.Room, bool) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -39,35 +91,127 @@ func (s *Store) GetRoom(roomID string) (*models.Room, bool) {
 	return room, exists
 }
 
+// Rooms returns all stored rooms
+func (s *MemoryStore) Rooms() []*models.Room {
+	return s.list()
+}
+
 // DeleteRoom removes a room from the store
-func (s *Store) DeleteRoom(roomID string) bool {
+func (s *MemoryStore) DeleteRoom(roomID string) bool {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if _, exists := s.rooms[roomID]; !exists {
+	room, exists := s.rooms[roomID]
+	if !exists {
 		return false
 	}
 
 	delete(s.rooms, roomID)
+	room.Close()
+
 	return true
 }
 
 // CleanupEmptyRooms removes rooms that have no players
-func (s *Store) CleanupEmptyRooms() int {
+func (s *MemoryStore) CleanupEmptyRooms() int {
+	return len(s.cleanupEmptyRooms())
+}
+
+// ExpireRooms removes rooms that have been idle or open for too long
+func (s *MemoryStore) ExpireRooms(expiry models.Expiry) int {
+	return len(s.expireRooms(expiry))
+}
+
+// Ping always succeeds for the in-memory store
+func (s *MemoryStore) Ping() error {
+	return nil
+}
+
+// Close closes every room, stopping their timers
+func (s *MemoryStore) Close() error {
+	s.closeAll()
+	return nil
+}
+
+// add stores an existing room
+func (s *MemoryStore) add(room *models.Room) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	count := 0
-	for id, room := range s.rooms {
-		room.Mutex.RLock()
-		isEmpty := len(room.Players) == 0
-		room.Mutex.RUnlock()
+	s.rooms[room.ID] = room
+}
+
+// remove drops a room from the store and closes it, unless it was replaced
+func (s *MemoryStore) remove(roomID string, room *models.Room) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.rooms[roomID] == room {
+		delete(s.rooms, roomID)
+	}
+	room.Close()
+}
+
+// list returns all stored rooms
+func (s *MemoryStore) list() []*models.Room {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	rooms := make([]*models.Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+
+	return rooms
+}
+
+// closeAll closes every stored room and empties the store, returning once
+// the timers of the rooms are stopped
+func (s *MemoryStore) closeAll() {
+	s.mutex.Lock()
+	rooms := s.rooms
+	s.rooms = make(map[string]*models.Room)
+	s.mutex.Unlock()
 
-		if isEmpty {
+	for _, room := range rooms {
+		room.Close()
+	}
+	for _, room := range rooms {
+		<-room.Stopped()
+	}
+}
+
+// expireRooms removes expired rooms, disconnecting their clients, and returns
+// their IDs
+func (s *MemoryStore) expireRooms(expiry models.Expiry) []string {
+	now := time.Now()
+
+	var expired []string
+	for _, room := range s.list() {
+		if room.CheckExpiry(expiry, now) {
+			s.remove(room.ID, room)
+			expired = append(expired, room.ID)
+		}
+	}
+	metrics.RoomsExpired.Add(uint64(len(expired)))
+
+	return expired
+}
+
+// cleanupEmptyRooms removes rooms that have no players and returns their IDs
+func (s *MemoryStore) cleanupEmptyRooms() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var removed []string
+	for id, room := range s.rooms {
+		if len(room.Snapshot().Players) == 0 {
 			delete(s.rooms, id)
-			count++
+			room.Close()
+			removed = append(removed, id)
 		}
 	}
+	metrics.RoomsCleanedUp.Add(uint64(len(removed)))
 
-	return count
+	return removed
 }
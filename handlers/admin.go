@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Arvi89/poker-go/db"
+	"github.com/Arvi89/poker-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader carries the admin API key, as an alternative to the
+// Authorization header
+const apiKeyHeader = "X-API-Key"
+
+// defaultCloseReason is told to the clients of a room closed without a reason
+const defaultCloseReason = "closed by an administrator"
+
+// roomSummary describes a room in the admin room list
+type roomSummary struct {
+	ID           string    `json:"id"`
+	Status       string    `json:"status"`
+	Players      int       `json:"players"`
+	Connected    int       `json:"connected"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+}
+
+// AdminHandler handles the requests of operators managing the rooms of the
+// store
+type AdminHandler struct {
+	store db.RoomStore
+}
+
+// NewAdminHandler creates a new AdminHandler
+func NewAdminHandler(store db.RoomStore) *AdminHandler {
+	return &AdminHandler{store: store}
+}
+
+// AdminAuth rejects requests that do not carry the given API key, either as a
+// bearer token or in the X-API-Key header
+func AdminAuth(apiKey string) gin.HandlerFunc {
+	// Hashing both keys makes the comparison independent of their length
+	expected := sha256.Sum256([]byte(apiKey))
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(apiKeyHeader)
+		if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		given := sha256.Sum256([]byte(key))
+		if key == "" || subtle.ConstantTimeCompare(given[:], expected[:]) != 1 {
+			requestLogger(c).Warn("Rejected admin request", "path", c.Request.URL.Path, "client", c.ClientIP())
+			c.Header("WWW-Authenticate", "Bearer")
+			errorResponse(c, models.ErrInvalidAPIKey)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// ListRooms lists the rooms held by this instance, most recently active first
+func (h *AdminHandler) ListRooms(c *gin.Context) {
+	rooms := h.store.Rooms()
+	summaries := make([]roomSummary, 0, len(rooms))
+
+	for _, room := range rooms {
+		view := room.Snapshot()
+
+		connected := 0
+		for _, player := range view.Players {
+			if player.Presence == models.PresenceConnected {
+				connected++
+			}
+		}
+
+		summaries = append(summaries, roomSummary{
+			ID:           view.ID,
+			Status:       view.Status,
+			Players:      len(view.Players),
+			Connected:    connected,
+			CreatedAt:    view.CreatedAt,
+			LastActivity: view.LastActivity,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].LastActivity.After(summaries[j].LastActivity)
+	})
+
+	standardResponse(c, http.StatusOK, "ok", summaries, "")
+}
+
+// GetRoom returns the full state of a room, including votes not revealed yet
+func (h *AdminHandler) GetRoom(c *gin.Context) {
+	room, exists := h.store.GetRoom(c.Param("id"))
+	if !exists {
+		errorResponse(c, models.ErrRoomNotFound)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "ok", room.Snapshot(), "")
+}
+
+// CloseRoom tells the clients of a room it is closing, with an optional
+// reason, then removes it
+func (h *AdminHandler) CloseRoom(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&req); err != nil {
+			standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = defaultCloseReason
+	}
+
+	room, exists := h.store.GetRoom(c.Param("id"))
+	if !exists {
+		errorResponse(c, models.ErrRoomNotFound)
+		return
+	}
+
+	room.AnnounceClosure(req.Reason)
+	h.store.DeleteRoom(room.ID)
+
+	standardResponse(c, http.StatusOK, "room_closed", nil, "")
+}
+
+// KickPlayer removes a player from a room, disconnecting their clients
+func (h *AdminHandler) KickPlayer(c *gin.Context) {
+	room, exists := h.store.GetRoom(c.Param("id"))
+	if !exists {
+		errorResponse(c, models.ErrRoomNotFound)
+		return
+	}
+
+	if !room.KickPlayer(c.Param("playerId")) {
+		errorResponse(c, models.ErrPlayerNotFound)
+		return
+	}
+
+	// Cleanup if the room is empty
+	if len(room.Snapshot().Players) == 0 {
+		h.store.DeleteRoom(room.ID)
+	}
+
+	standardResponse(c, http.StatusOK, "player_kicked", nil, "")
+}
+
+// CleanupRooms removes the rooms that have no players
+func (h *AdminHandler) CleanupRooms(c *gin.Context) {
+	count := h.store.CleanupEmptyRooms()
+	requestLogger(c).Info("Cleaned up empty rooms", "count", count)
+
+	standardResponse(c, http.StatusOK, "cleaned_up", gin.H{"removed": count}, "")
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cache policies of the web client. Asset URLs carrying the hash of their
+// content never change, other responses must be revalidated with their ETag.
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+// assetVersionLength is the number of hex digits of the content hash tagging
+// asset URLs
+const assetVersionLength = 12
+
+// asset is a file of the web client with the hash of its content
+type asset struct {
+	content []byte
+	hash    string
+}
+
+// etag returns the entity tag of the asset
+func (a *asset) etag() string {
+	return `"` + a.hash + `"`
+}
+
+// Assets serves the static files and the page of the web client, either
+// embedded in the binary or, for development, read from a directory on every
+// request so that edits show up without a rebuild
+type Assets struct {
+	files  fs.FS
+	static fs.FS
+	dev    bool
+
+	// Embedded files never change, so they are hashed and parsed once
+	mutex    sync.Mutex
+	cache    map[string]*asset
+	template *template.Template
+}
+
+// NewAssets creates the handler of the web client, serving the static/ and
+// templates/ directories of the embedded files, or of dir if set
+func NewAssets(embedded fs.FS, dir string) (*Assets, error) {
+	a := &Assets{
+		files: embedded,
+		cache: make(map[string]*asset),
+	}
+	if dir != "" {
+		a.files = os.DirFS(dir)
+		a.dev = true
+	}
+
+	// Static files are served from their own directory, so that no request
+	// can reach the templates or other files of the development directory
+	static, err := fs.Sub(a.files, "static")
+	if err != nil {
+		return nil, err
+	}
+	a.static = static
+
+	// Fail early on missing or broken templates
+	tmpl, err := a.parseTemplates()
+	if err != nil {
+		return nil, err
+	}
+	if !a.dev {
+		a.template = tmpl
+	}
+
+	return a, nil
+}
+
+// Static serves a file of the static/ directory
+func (a *Assets) Static(c *gin.Context) {
+	a.serveStatic(c, strings.TrimPrefix(c.Param("filepath"), "/"))
+}
+
+// Favicon serves the icon of the application
+func (a *Assets) Favicon(c *gin.Context) {
+	a.serveStatic(c, "favicon.ico")
+}
+
+// Page serves the page of the web client
+func (a *Assets) Page(c *gin.Context) {
+	tmpl := a.template
+	if a.dev {
+		var err error
+		if tmpl, err = a.parseTemplates(); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	var page bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&page, "index.html", nil); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// The page links to the current version of the assets, so it is always
+	// revalidated
+	c.Header("Cache-Control", cacheRevalidate)
+	serveAsset(c, "index.html", newAsset(page.Bytes()))
+}
+
+// serveStatic serves a file of the static/ directory. Requests for the
+// version of the file linked by the page are cached for good.
+func (a *Assets) serveStatic(c *gin.Context, name string) {
+	file, err := a.load(name)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if version := c.Query("v"); !a.dev && version != "" && version == file.hash[:assetVersionLength] {
+		c.Header("Cache-Control", cacheImmutable)
+	} else {
+		c.Header("Cache-Control", cacheRevalidate)
+	}
+
+	serveAsset(c, name, file)
+}
+
+// load reads a file of the static/ directory, from the cache for embedded
+// files
+func (a *Assets) load(name string) (*asset, error) {
+	if !validAssetName(name) {
+		return nil, fs.ErrNotExist
+	}
+
+	if !a.dev {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+
+		if cached, exists := a.cache[name]; exists {
+			return cached, nil
+		}
+	}
+
+	content, err := fs.ReadFile(a.static, name)
+	if err != nil {
+		return nil, err
+	}
+	file := newAsset(content)
+
+	if !a.dev {
+		a.cache[name] = file
+	}
+
+	return file, nil
+}
+
+// parseTemplates parses the templates/ directory, with an asset function
+// returning the URL of a static file tagged with the hash of its content
+func (a *Assets) parseTemplates() (*template.Template, error) {
+	funcs := template.FuncMap{
+		"asset": func(name string) (string, error) {
+			file, err := a.load(name)
+			if err != nil {
+				return "", fmt.Errorf("asset %s: %w", name, err)
+			}
+
+			return "/static/" + name + "?v=" + file.hash[:assetVersionLength], nil
+		},
+	}
+
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(a.files, "templates/*")
+	if err != nil {
+		return nil, fmt.Errorf("parse templates: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// validAssetName reports whether a requested name stays within the static/
+// directory. fs.ValidPath rejects rooted paths and every "." or ".." element,
+// so a valid path cannot escape it.
+func validAssetName(name string) bool {
+	return fs.ValidPath(name)
+}
+
+// newAsset hashes the content of a file
+func newAsset(content []byte) *asset {
+	sum := sha256.Sum256(content)
+	return &asset{content: content, hash: hex.EncodeToString(sum[:])}
+}
+
+// serveAsset sends a file with its ETag, answering conditional and range
+// requests
+func serveAsset(c *gin.Context, name string, file *asset) {
+	c.Header("ETag", file.etag())
+	http.ServeContent(c.Writer, c.Request, name, time.Time{}, bytes.NewReader(file.content))
+}
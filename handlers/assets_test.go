@@ -0,0 +1,22 @@
+package handlers
+
+import "testing"
+
+func TestValidAssetName(t *testing.T) {
+	tests := map[string]bool{
+		"js/app.js":       true,
+		"css/style.css":   true,
+		"../main.go":      false,
+		"js/../../secret": false,
+		"js/./app.js":     false,
+		"/etc/passwd":     false,
+		"js//app.js":      false,
+		"":                false,
+	}
+
+	for name, want := range tests {
+		if got := validAssetName(name); got != want {
+			t.Errorf("validAssetName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/Arvi89/poker-go/models"
+	"github.com/gorilla/websocket"
+)
+
+// Commands clients can send over their WebSocket connection
+const (
+	commandVote     = "vote"
+	commandReveal   = "reveal"
+	commandReset    = "reset"
+	commandSetLink  = "set_link"
+	commandTransfer = "transfer"
+	commandPing     = "ping"
+)
+
+// Replies sent back for each command
+const (
+	replyAck   = "ack"
+	replyError = "error"
+)
+
+// maxCommandSize is the largest message accepted from a WebSocket client
+const maxCommandSize = 4096
+
+// Command protocol errors
+var (
+	errInvalidCommand = errors.New("invalid command")
+	errUnknownCommand = errors.New("unknown command")
+)
+
+// command is a request sent by a client over its WebSocket connection. The ID
+// is chosen by the client and echoed in the reply.
+type command struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// commandReply acknowledges a command, or reports why it failed
+type commandReply struct {
+	Type  string `json:"type"`
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// readCommands reads the commands sent by a client and passes them on in
+// order. Messages that are not valid commands are passed on without a type.
+// It returns when the connection is closed, or when stop is closed.
+func readCommands(conn *websocket.Conn, commands chan<- command, stop <-chan struct{}) {
+	conn.SetReadLimit(maxCommandSize)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			// Client disconnected or error occurred
+			return
+		}
+
+		var cmd command
+		if json.Unmarshal(data, &cmd) != nil {
+			cmd = command{}
+		}
+
+		select {
+		case commands <- cmd:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// runCommand runs a command on behalf of a player and returns its reply
+func runCommand(room *models.Room, playerID string, cmd command) commandReply {
+	if err := applyCommand(room, playerID, cmd); err != nil {
+		return commandReply{Type: replyError, ID: cmd.ID, Error: err.Error()}
+	}
+
+	return commandReply{Type: replyAck, ID: cmd.ID}
+}
+
+// applyCommand applies a command to the room
+func applyCommand(room *models.Room, playerID string, cmd command) error {
+	switch cmd.Type {
+	case "":
+		return errInvalidCommand
+
+	case commandVote:
+		var payload struct {
+			Card models.Card `json:"card"`
+		}
+		if err := decodePayload(cmd, &payload); err != nil {
+			return err
+		}
+
+		return room.SubmitVote(playerID, payload.Card)
+
+	case commandReveal:
+		return room.RevealCards(playerID)
+
+	case commandReset:
+		return room.ResetVoting(playerID)
+
+	case commandSetLink:
+		var payload struct {
+			Link string `json:"link"`
+		}
+		if err := decodePayload(cmd, &payload); err != nil {
+			return err
+		}
+
+		return room.UpdateLink(playerID, payload.Link)
+
+	case commandTransfer:
+		var payload struct {
+			NewCreatorID string `json:"newCreatorID"`
+		}
+		if err := decodePayload(cmd, &payload); err != nil {
+			return err
+		}
+
+		return room.TransferCreator(playerID, payload.NewCreatorID)
+
+	case commandPing:
+		// The acknowledgement is the answer
+
+	default:
+		return errUnknownCommand
+	}
+
+	return nil
+}
+
+// decodePayload decodes the payload of a command
+func decodePayload(cmd command, payload interface{}) error {
+	if len(cmd.Payload) == 0 {
+		return errInvalidCommand
+	}
+
+	if err := json.Unmarshal(cmd.Payload, payload); err != nil {
+		return errInvalidCommand
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Arvi89/poker-go/models"
+)
+
+func TestApplyCommandErrors(t *testing.T) {
+	room := models.NewRoom("alice", models.DefaultDeck())
+	defer room.Close()
+
+	var creatorID string
+	for id := range room.Snapshot().Players {
+		creatorID = id
+	}
+	bobID, err := room.AddPlayer("bob", models.RoleVoter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transfer := command{Type: commandTransfer, Payload: json.RawMessage(`{"newCreatorID":"nobody"}`)}
+
+	tests := []struct {
+		name     string
+		playerID string
+		cmd      command
+		want     error
+	}{
+		{"voter revealing", bobID, command{Type: commandReveal}, models.ErrNotCreator},
+		{"voter resetting", bobID, command{Type: commandReset}, models.ErrNotCreator},
+		{"transfer to a stranger", creatorID, transfer, models.ErrPlayerNotFound},
+		{"creator revealing", creatorID, command{Type: commandReveal}, nil},
+	}
+
+	for _, test := range tests {
+		if err := applyCommand(room, test.playerID, test.cmd); err != test.want {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.want)
+		}
+	}
+
+	// Commands on a closed room report it gone rather than a permission issue
+	room.Close()
+	for _, cmdType := range []string{commandReveal, commandReset} {
+		if err := applyCommand(room, creatorID, command{Type: cmdType}); err != models.ErrRoomNotFound {
+			t.Errorf("%s on a closed room: error = %v, want %v", cmdType, err, models.ErrRoomNotFound)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Arvi89/poker-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+// ExportHistory handles requests to export the room's vote history as JSON
+// or, with format=csv, as a CSV file
+func (h *RoomHandler) ExportHistory(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	history := room.ViewFor(playerID).VoteHistory
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		standardResponse(c, http.StatusOK, "ok", history, "")
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="poker-%s.csv"`, room.ID))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+
+		if err := writeHistoryCSV(c.Writer, history); err != nil {
+			c.Error(err)
+		}
+	default:
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Unsupported export format")
+	}
+}
+
+// writeHistoryCSV writes one row per voting session
+func writeHistoryCSV(w http.ResponseWriter, history []models.VoteSession) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"timestamp", "story", "link", "estimate", "suggested", "mean", "median", "consensus", "votes"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, session := range history {
+		var suggested, mean, median, consensus string
+		if result := session.Result; result != nil {
+			suggested = string(result.Suggested)
+			mean = formatStat(result.Mean)
+			median = formatStat(result.Median)
+			consensus = strconv.FormatBool(result.Consensus)
+		}
+
+		// List votes as "name=card", sorted by name
+		votes := make([]string, 0, len(session.Players))
+		for _, player := range session.Players {
+			if player.Card != models.Unknown {
+				votes = append(votes, player.Name+"="+string(player.Card))
+			}
+		}
+		sort.Strings(votes)
+
+		row := []string{
+			session.Timestamp.Format(time.RFC3339),
+			session.StoryTitle,
+			session.Link,
+			string(session.Estimate),
+			suggested,
+			mean,
+			median,
+			consensus,
+			strings.Join(votes, "; "),
+		}
+		for i, cell := range row {
+			row[i] = escapeFormula(cell)
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeFormula prefixes a cell starting like a formula with a quote, so that
+// spreadsheets opening the export show titles, links and names chosen by
+// players as text instead of running them
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+
+	return cell
+}
+
+// formatStat formats an optional statistic
+func formatStat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
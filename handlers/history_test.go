@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Arvi89/poker-go/models"
+)
+
+func TestWriteHistoryCSVEscapesFormulas(t *testing.T) {
+	history := []models.VoteSession{{
+		Timestamp:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		StoryTitle: `=HYPERLINK("http://example.com","click")`,
+		Link:       "@SUM(A1)",
+		Estimate:   "5",
+		Players: map[string]*models.Player{
+			"a": {Name: "+alice", Card: "5"},
+		},
+	}}
+
+	recorder := httptest.NewRecorder()
+	if err := writeHistoryCSV(recorder, history); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %d, want a header and a session", len(rows))
+	}
+
+	row := rows[1]
+	want := map[int]string{
+		1: `'=HYPERLINK("http://example.com","click")`,
+		2: "'@SUM(A1)",
+		3: "5",
+		8: "'+alice=5",
+	}
+	for column, cell := range want {
+		if row[column] != cell {
+			t.Errorf("%s = %q, want %q", rows[0][column], row[column], cell)
+		}
+	}
+
+	for _, cell := range []string{"-1", "\tx", "\rx"} {
+		if escaped := escapeFormula(cell); escaped != "'"+cell {
+			t.Errorf("escapeFormula(%q) = %q", cell, escaped)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the ID correlating the logs of a request, given by
+// the client or a proxy, or else generated
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of the request ID
+const requestIDKey = "requestID"
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// RequestID tags each request with an ID, returned in the X-Request-ID header
+// and attached to the logs of the request
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set(requestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// AccessLog logs each request once it is served. WebSocket connections and
+// event streams are logged when they close.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		requestLogger(c).Log(c.Request.Context(), level, "Request served",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"route", c.FullPath(),
+			"status", status,
+			"duration", time.Since(start),
+			"client", c.ClientIP(),
+		)
+	}
+}
+
+// requestLogger returns the logger for records about a request
+func requestLogger(c *gin.Context) *slog.Logger {
+	return slog.With("request_id", c.GetString(requestIDKey))
+}
+
+// validRequestID reports whether a request ID given by a client is short and
+// printable enough to be logged
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, char := range requestID {
+		if char < '!' || char > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Arvi89/poker-go/db"
+	"github.com/Arvi89/poker-go/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// RequestMetrics measures the time taken to serve each request, by route.
+// WebSocket connections and event streams are left out, since they last as
+// long as the client stays.
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if websocket.IsWebSocketUpgrade(c.Request) || c.GetHeader("Accept") == "text/event-stream" {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		// Unmatched requests share a route so that they cannot flood the labels
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequestDuration.Observe(
+			time.Since(start).Seconds(),
+			c.Request.Method,
+			route,
+			strconv.Itoa(c.Writer.Status()),
+		)
+	}
+}
+
+// RegisterStoreMetrics exposes the number of rooms and players held by a store
+func RegisterStoreMetrics(store db.RoomStore) {
+	metrics.RegisterGaugeFunc("poker_rooms_active", "Rooms held by this instance.", func() float64 {
+		return float64(len(store.Rooms()))
+	})
+
+	metrics.RegisterGaugeFunc("poker_players", "Players in the rooms held by this instance.", func() float64 {
+		players := 0
+		for _, room := range store.Rooms() {
+			players += len(room.Snapshot().Players)
+		}
+
+		return float64(players)
+	})
+}
+
+// Metrics serves the server metrics in the Prometheus text format
+func Metrics(c *gin.Context) {
+	c.Header("Content-Type", metrics.ContentType)
+	metrics.WriteText(c.Writer)
+}
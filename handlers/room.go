@@ -2,22 +2,35 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Arvi89/poker-go/config"
 	"github.com/Arvi89/poker-go/db"
+	"github.com/Arvi89/poker-go/metrics"
 	"github.com/Arvi89/poker-go/models"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-// Package-level WebSocket upgrader
-var wsUpgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins
-	},
-}
+// WebSocket close codes specific to the application
+const (
+	// closeSlowConsumer tells a client it was disconnected for missing too
+	// many events and must resync
+	closeSlowConsumer = 4008
+
+	// closeRemoved tells a client its player was removed from the room and
+	// must not reconnect
+	closeRemoved = 4003
+)
+
+// Session token transport
+const (
+	sessionHeader = "X-Session-Token"
+	sessionCookie = "poker_session"
+)
 
 // standardResponse sends a consistent JSON response
 func standardResponse(c *gin.Context, code int, status string, data interface{}, err string) {
@@ -34,22 +47,161 @@ func standardResponse(c *gin.Context, code int, status string, data interface{},
 	c.JSON(code, response)
 }
 
+// errorResponse sends an error response with a status code matching the error
+func errorResponse(c *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	switch err {
+	case models.ErrRoomNotFound, models.ErrPlayerNotFound, models.ErrStoryNotFound:
+		code = http.StatusNotFound
+	case models.ErrNotCreator, models.ErrObserverCannotVote, models.ErrCreatorRole:
+		code = http.StatusForbidden
+	case models.ErrInvalidSession, models.ErrInvalidAPIKey:
+		code = http.StatusUnauthorized
+	case models.ErrInvalidCard, models.ErrInvalidDeck, models.ErrInvalidStory, models.ErrInvalidOrder,
+		models.ErrInvalidSettings, models.ErrInvalidTimer, models.ErrInvalidRole:
+		code = http.StatusBadRequest
+	case models.ErrPlayerExists, models.ErrNoPendingStory, models.ErrNotRevealed, models.ErrNoTimer,
+		models.ErrNotVoting, models.ErrVotingLocked:
+		code = http.StatusConflict
+	case models.ErrShuttingDown:
+		code = http.StatusServiceUnavailable
+	}
+
+	standardResponse(c, code, "error", nil, err.Error())
+}
+
+// sessionToken returns the session token sent with the request, taken from
+// the Authorization or X-Session-Token header, or else the session cookie.
+// Browsers cannot set headers on WebSocket handshakes or event streams, which
+// rely on the cookie: tokens are never read from the URL, where they would
+// end up in access logs and browser history.
+func sessionToken(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+
+	if token := c.GetHeader(sessionHeader); token != "" {
+		return token
+	}
+
+	if token, err := c.Cookie(sessionCookie); err == nil {
+		return token
+	}
+
+	return ""
+}
+
+// setSessionCookie stores the session token in a cookie scoped to the room's API
+func setSessionCookie(c *gin.Context, roomID, token string) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookie, token, 0, "/api/rooms/"+roomID, "", c.Request.TLS != nil, true)
+}
+
+// clearSessionCookie removes the session cookie of a room
+func clearSessionCookie(c *gin.Context, roomID string) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookie, "", -1, "/api/rooms/"+roomID, "", c.Request.TLS != nil, true)
+}
+
 // RoomHandler handles all room-related requests
 type RoomHandler struct {
-	store *db.Store
+	store          db.RoomStore
+	reconnectGrace time.Duration
+	pingInterval   time.Duration
+	upgrader       websocket.Upgrader
+
+	// Shutdown state, see Shutdown
+	drainMutex     sync.Mutex
+	draining       bool
+	reconnectAfter time.Duration
+	shutdown       chan struct{}
+	shutdownOnce   sync.Once
+	streams        sync.WaitGroup
 }
 
-// NewRoomHandler creates a new RoomHandler
-func NewRoomHandler(store *db.Store) *RoomHandler {
+// NewRoomHandler creates a new RoomHandler. Players whose last connection
+// drops are removed from their room unless they reconnect within the
+// configured grace period.
+func NewRoomHandler(store db.RoomStore, cfg *config.Config) *RoomHandler {
 	return &RoomHandler{
-		store: store,
+		store:          store,
+		reconnectGrace: cfg.Rooms.ReconnectGrace,
+		pingInterval:   cfg.WebSocket.PingInterval,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  cfg.WebSocket.ReadBufferSize,
+			WriteBufferSize: cfg.WebSocket.WriteBufferSize,
+			CheckOrigin:     checkOrigin(allowedOrigins(cfg)),
+		},
+		shutdown: make(chan struct{}),
+	}
+}
+
+// allowedOrigins returns the origins allowed to open WebSockets, defaulting
+// to the origins allowed by CORS
+func allowedOrigins(cfg *config.Config) []string {
+	if len(cfg.WebSocket.AllowedOrigins) > 0 {
+		return cfg.WebSocket.AllowedOrigins
+	}
+
+	return cfg.CORSOrigins
+}
+
+// checkOrigin returns the origin check of the WebSocket upgrader, accepting
+// the given origins, or only the server's own origin if none is given
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	if len(allowed) == 0 {
+		// The upgrader checks for the same origin by default
+		return nil
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		for _, o := range allowed {
+			if o == "*" || strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+
+		return false
 	}
 }
 
+// authenticate looks up the requested room and the player owning the
+// request's session token, sending an error response if either is missing
+func (h *RoomHandler) authenticate(c *gin.Context) (*models.Room, string, bool) {
+	room, exists := h.store.GetRoom(c.Param("id"))
+	if !exists {
+		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+		return nil, "", false
+	}
+
+	token := sessionToken(c)
+	playerID, ok := room.Authenticate(token)
+	if !ok {
+		standardResponse(c, http.StatusUnauthorized, "error", nil, models.ErrInvalidSession.Error())
+		return nil, "", false
+	}
+
+	// Keep the cookie in step with the token the client sends in its headers,
+	// so that its WebSocket or event stream authenticates as the same player
+	if cookie, err := c.Cookie(sessionCookie); err != nil || cookie != token {
+		setSessionCookie(c, room.ID, token)
+	}
+
+	return room, playerID, true
+}
+
 // CreateRoom handles room creation requests
 func (h *RoomHandler) CreateRoom(c *gin.Context) {
+	if h.Draining() {
+		errorResponse(c, models.ErrShuttingDown)
+		return
+	}
+
 	var req struct {
-		Name string `json:"name" binding:"required"`
+		Name  string            `json:"name" binding:"required"`
+		Deck  string            `json:"deck"`
+		Cards []models.DeckCard `json:"cards"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -63,30 +215,60 @@ func (h *RoomHandler) CreateRoom(c *gin.Context) {
 		return
 	}
 
-	room := h.store.CreateRoom(req.Name)
+	// Use the custom cards if given, otherwise the requested preset
+	deck := models.DefaultDeck()
+	if len(req.Cards) > 0 {
+		custom, err := models.NewCustomDeck(req.Cards)
+		if err != nil {
+			standardResponse(c, http.StatusBadRequest, "error", nil, err.Error())
+			return
+		}
+		deck = custom
+	} else if req.Deck != "" {
+		preset, exists := models.PresetDeck(req.Deck)
+		if !exists {
+			standardResponse(c, http.StatusBadRequest, "error", nil, models.ErrInvalidDeck.Error())
+			return
+		}
+		deck = preset
+	}
+
+	room := h.store.CreateRoom(req.Name, deck)
 
 	// Find the creator player ID
 	var creatorID string
-	room.Mutex.RLock()
-	for id, player := range room.Players {
+	for id, player := range room.Snapshot().Players {
 		if player.IsCreator {
 			creatorID = id
 			break
 		}
 	}
-	room.Mutex.RUnlock()
+
+	token, err := room.IssueToken(creatorID)
+	if err != nil {
+		standardResponse(c, http.StatusInternalServerError, "error", nil, "Could not create session")
+		return
+	}
+	setSessionCookie(c, room.ID, token)
 
 	standardResponse(c, http.StatusCreated, "created", gin.H{
 		"roomId":   room.ID,
 		"playerID": creatorID,
+		"token":    token,
 	}, "")
 }
 
+// ListDecks returns the built-in card decks
+func (h *RoomHandler) ListDecks(c *gin.Context) {
+	standardResponse(c, http.StatusOK, "ok", models.PresetDecks(), "")
+}
+
 // JoinRoom handles requests to join a room
 func (h *RoomHandler) JoinRoom(c *gin.Context) {
 	roomID := c.Param("id")
 	var req struct {
 		Name string `json:"name" binding:"required"`
+		Role string `json:"role"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -106,28 +288,33 @@ func (h *RoomHandler) JoinRoom(c *gin.Context) {
 		return
 	}
 
-	playerID, success := room.AddPlayer(req.Name)
-	if !success {
-		standardResponse(c, http.StatusConflict, "error", nil, models.ErrPlayerExists.Error())
+	if req.Role == "" {
+		req.Role = models.RoleVoter
+	}
+
+	playerID, err := room.AddPlayer(req.Name, req.Role)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	token, err := room.IssueToken(playerID)
+	if err != nil {
+		standardResponse(c, http.StatusInternalServerError, "error", nil, "Could not create session")
 		return
 	}
+	setSessionCookie(c, room.ID, token)
 
-	standardResponse(c, http.StatusOK, "joined", gin.H{"playerID": playerID}, "")
+	standardResponse(c, http.StatusOK, "joined", gin.H{
+		"playerID": playerID,
+		"token":    token,
+	}, "")
 }
 
 // LeaveRoom handles requests to leave a room
 func (h *RoomHandler) LeaveRoom(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
-
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
-		return
-	}
-
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
@@ -137,53 +324,83 @@ func (h *RoomHandler) LeaveRoom(c *gin.Context) {
 	}
 
 	// Cleanup if the room is empty
-	room.Mutex.RLock()
-	isEmpty := len(room.Players) == 0
-	room.Mutex.RUnlock()
-
-	if isEmpty {
-		h.store.DeleteRoom(roomID)
+	if len(room.Snapshot().Players) == 0 {
+		h.store.DeleteRoom(room.ID)
 	}
 
+	clearSessionCookie(c, room.ID)
 	standardResponse(c, http.StatusOK, "left", nil, "")
 }
 
 // GetRoom handles requests to get room information
 func (h *RoomHandler) GetRoom(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	// Return the room as seen by this player
+	c.JSON(http.StatusOK, room.ViewFor(playerID))
+}
 
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
+// SubmitVote handles vote submission requests
+func (h *RoomHandler) SubmitVote(c *gin.Context) {
+	var req struct {
+		Card models.Card `json:"card" binding:"required"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	if err := room.SubmitVote(playerID, req.Card); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "vote_submitted", nil, "")
+}
+
+// RevealCards handles requests to reveal all cards
+func (h *RoomHandler) RevealCards(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	// Verify player exists in the room
-	room.Mutex.RLock()
-	_, playerExists := room.Players[playerID]
-	room.Mutex.RUnlock()
+	if err := room.RevealCards(playerID); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "cards_revealed", nil, "")
+}
+
+// ResetVoting handles requests to reset voting
+func (h *RoomHandler) ResetVoting(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
 
-	if !playerExists {
-		standardResponse(c, http.StatusForbidden, "error", nil, models.ErrPlayerNotFound.Error())
+	if err := room.ResetVoting(playerID); err != nil {
+		errorResponse(c, err)
 		return
 	}
 
-	// Return the full room data as-is
-	c.JSON(http.StatusOK, room)
+	standardResponse(c, http.StatusOK, "voting_reset", nil, "")
 }
 
-// SubmitVote handles vote submission requests
-func (h *RoomHandler) SubmitVote(c *gin.Context) {
-	roomID := c.Param("id")
+// SetEstimate handles requests to record the agreed estimate of the round
+func (h *RoomHandler) SetEstimate(c *gin.Context) {
 	var req struct {
-		PlayerID string      `json:"playerID" binding:"required"`
-		Card     models.Card `json:"card" binding:"required"`
+		Estimate models.Card `json:"estimate" binding:"required"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -191,73 +408,88 @@ func (h *RoomHandler) SubmitVote(c *gin.Context) {
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	if success := room.SubmitVote(req.PlayerID, req.Card); !success {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrPlayerNotFound.Error())
+	if err := room.SetEstimate(playerID, req.Estimate); err != nil {
+		errorResponse(c, err)
 		return
 	}
 
-	standardResponse(c, http.StatusOK, "vote_submitted", nil, "")
+	standardResponse(c, http.StatusOK, "estimate_accepted", nil, "")
 }
 
-// RevealCards handles requests to reveal all cards
-func (h *RoomHandler) RevealCards(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
+// UpdateSettings handles requests to change the room settings
+func (h *RoomHandler) UpdateSettings(c *gin.Context) {
+	var req models.SettingsUpdate
 
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	if success := room.RevealCards(playerID); !success {
-		standardResponse(c, http.StatusForbidden, "error", nil, models.ErrNotCreator.Error())
+	if err := room.UpdateSettings(playerID, req); err != nil {
+		errorResponse(c, err)
 		return
 	}
 
-	standardResponse(c, http.StatusOK, "cards_revealed", nil, "")
+	standardResponse(c, http.StatusOK, "settings_updated", nil, "")
 }
 
-// ResetVoting handles requests to reset voting
-func (h *RoomHandler) ResetVoting(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
+// StartTimer handles requests to start a countdown for the current round
+func (h *RoomHandler) StartTimer(c *gin.Context) {
+	var req struct {
+		Duration int    `json:"duration" binding:"required"`
+		Action   string `json:"action"`
+		Tick     bool   `json:"tick"`
+	}
 
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	if req.Action == "" {
+		req.Action = models.TimerActionReveal
+	}
+
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	if success := room.ResetVoting(playerID); !success {
-		standardResponse(c, http.StatusForbidden, "error", nil, models.ErrNotCreator.Error())
+	if err := room.StartTimer(playerID, req.Duration, req.Action, req.Tick); err != nil {
+		errorResponse(c, err)
 		return
 	}
 
-	standardResponse(c, http.StatusOK, "voting_reset", nil, "")
+	standardResponse(c, http.StatusOK, "timer_started", nil, "")
+}
+
+// CancelTimer handles requests to stop the round countdown
+func (h *RoomHandler) CancelTimer(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	if err := room.CancelTimer(playerID); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "timer_cancelled", nil, "")
 }
 
 // UpdateLink handles requests to update the room link
 func (h *RoomHandler) UpdateLink(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
-
 	var req struct {
 		Link string `json:"link"`
 	}
@@ -267,30 +499,45 @@ func (h *RoomHandler) UpdateLink(c *gin.Context) {
 		return
 	}
 
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	if err := room.UpdateLink(playerID, req.Link); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "link_updated", nil, "")
+}
+
+// SetRole handles requests to change the role of a player
+func (h *RoomHandler) SetRole(c *gin.Context) {
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
 		return
 	}
 
-	if success := room.UpdateLink(playerID, req.Link); !success {
-		standardResponse(c, http.StatusForbidden, "error", nil, models.ErrNotCreator.Error())
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	standardResponse(c, http.StatusOK, "link_updated", nil, "")
+	if err := room.SetRole(playerID, c.Param("playerId"), req.Role); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "role_changed", nil, "")
 }
 
 // TransferCreator handles requests to transfer the creator role
 func (h *RoomHandler) TransferCreator(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
-
 	var req struct {
 		NewCreatorID string `json:"newCreatorID" binding:"required"`
 	}
@@ -300,19 +547,13 @@ func (h *RoomHandler) TransferCreator(c *gin.Context) {
 		return
 	}
 
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
-		return
-	}
-
-	if success := room.TransferCreator(playerID, req.NewCreatorID); !success {
-		standardResponse(c, http.StatusForbidden, "error", nil, models.ErrNotCreator.Error())
+	if err := room.TransferCreator(playerID, req.NewCreatorID); err != nil {
+		errorResponse(c, err)
 		return
 	}
 
@@ -321,79 +562,182 @@ func (h *RoomHandler) TransferCreator(c *gin.Context) {
 
 // WebSocketHandler handles WebSocket connections for real-time updates
 func (h *RoomHandler) WebSocketHandler(c *gin.Context) {
-	roomID := c.Param("id")
-	playerID := c.Query("playerID")
-
-	if playerID == "" {
-		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid player ID")
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
 		return
 	}
 
-	room, exists := h.store.GetRoom(roomID)
-	if !exists {
-		standardResponse(c, http.StatusNotFound, "error", nil, models.ErrRoomNotFound.Error())
+	if !h.trackStream() {
+		errorResponse(c, models.ErrShuttingDown)
 		return
 	}
+	defer h.streams.Done()
+
+	logger := requestLogger(c).With("room", room.ID, "player", playerID)
 
-	// Use the shared upgrader instead of creating a new one each time
-	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
+		logger.Warn("Failed to upgrade to WebSocket", "error", err)
 		standardResponse(c, http.StatusInternalServerError, "error", nil, "Could not upgrade to WebSocket")
 		return
 	}
 	defer conn.Close()
 
-	// Create a channel for this client
-	events := room.Subscribe()
-	defer room.Unsubscribe(events)
+	metrics.WebSocketConnections.Inc()
+	defer metrics.WebSocketConnections.Dec()
 
-	// Send initial room state
-	initialEvent := models.Event{
-		Type:    models.EventTypeInitialState,
-		Payload: room,
-	}
+	connectedAt := time.Now()
+	logger.Info("WebSocket connected")
+	defer func() {
+		logger.Info("WebSocket disconnected", "duration", time.Since(connectedAt))
+	}()
 
-	if err := conn.WriteJSON(initialEvent); err != nil {
+	// Track the connection so the player is only removed once they are gone
+	// for longer than the grace period
+	if err := room.Connect(playerID); err != nil {
 		return
 	}
+	defer room.Disconnect(playerID, h.reconnectGrace)
+
+	// Create a channel for this client, replaying the events it missed if it
+	// tells us the sequence number of the last one it received
+	events, backlog := subscribe(room, playerID, c.Query("since"))
+	defer room.Unsubscribe(events)
+
+	for _, event := range backlog {
+		if err := conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
 
 	// Setup ping ticker for keep-alive
-	ticker := time.NewTicker(15 * time.Second)
+	ticker := time.NewTicker(h.pingInterval)
 	defer ticker.Stop()
 
-	// Create a channel to handle client disconnections
-	done := make(chan struct{})
+	// Read client commands in a separate goroutine. They are run by this
+	// goroutine, the only writer of the connection, so that each reply
+	// follows the events caused by its command.
+	commands := make(chan command)
+	stop := make(chan struct{})
+	defer close(stop)
 
-	// Handle incoming messages in a separate goroutine
-	go handleIncomingMessages(conn, room, playerID, done)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		readCommands(conn, commands, stop)
+	}()
 
 	// Main event loop
 	for {
 		select {
-		case event := <-events:
-			if err := conn.WriteJSON(event); err != nil {
+		case event, open := <-events:
+			if !writeEvent(conn, room, playerID, event, open) {
+				return
+			}
+		case cmd := <-commands:
+			reply := runCommand(room, playerID, cmd)
+
+			// Events caused by the command were queued before it returned,
+			// send them first so the client sees them in order
+			if !flushEvents(conn, room, playerID, events) {
+				return
+			}
+
+			if err := conn.WriteJSON(reply); err != nil {
 				return
 			}
 		case <-ticker.C:
 			if err := conn.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
 				return
 			}
+		case <-h.shutdown:
+			closeForShutdown(conn, room, playerID, events)
+			return
 		case <-done:
 			return
 		}
 	}
 }
 
-// handleIncomingMessages processes messages from the client
-func handleIncomingMessages(conn *websocket.Conn, room *models.Room, playerID string, done chan struct{}) {
-	defer close(done)
+// subscribe registers a client for the events of a room and returns the
+// events to send it first: the ones it missed since the given cursor if they
+// are still available, or else the initial state of the room. Clients skip
+// queued events the initial state already covers.
+func subscribe(room *models.Room, playerID, since string) (chan models.Event, []models.Event) {
+	if instance, seq, ok := parseCursor(since); ok {
+		events, missed, resumed := room.Resume(playerID, instance, seq)
+		if resumed {
+			return events, missed
+		}
+
+		return events, []models.Event{initialState(room, playerID)}
+	}
+
+	return room.Subscribe(playerID), []models.Event{initialState(room, playerID)}
+}
+
+// parseCursor splits a client's position in the event stream, given as
+// "<instance>:<seq>" or as a bare sequence number
+func parseCursor(cursor string) (instance string, seq uint64, ok bool) {
+	if i := strings.LastIndex(cursor, ":"); i >= 0 {
+		instance, cursor = cursor[:i], cursor[i+1:]
+	}
+
+	seq, err := strconv.ParseUint(cursor, 10, 64)
+	return instance, seq, err == nil
+}
+
+// formatCursor returns the position of an event in the stream of an instance
+func formatCursor(instance string, seq uint64) string {
+	if instance == "" {
+		return strconv.FormatUint(seq, 10)
+	}
+
+	return instance + ":" + strconv.FormatUint(seq, 10)
+}
+
+// initialState returns the event carrying the room as seen by a player
+func initialState(room *models.Room, playerID string) models.Event {
+	view := room.ViewFor(playerID)
 
+	return models.Event{
+		Type:    models.EventTypeInitialState,
+		Seq:     view.Seq,
+		Payload: view,
+	}
+}
+
+// flushEvents sends the events already queued for a WebSocket client. It
+// reports false if the connection was closed.
+func flushEvents(conn *websocket.Conn, room *models.Room, playerID string, events chan models.Event) bool {
 	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			// Client disconnected or error occurred
-			room.RemovePlayer(playerID)
-			return
+		select {
+		case event, open := <-events:
+			if !writeEvent(conn, room, playerID, event, open) {
+				return false
+			}
+		default:
+			return true
 		}
 	}
 }
+
+// writeEvent sends an event received from the room to a WebSocket client. If
+// the event channel was closed, it closes the connection instead with the
+// reason, and reports false.
+func writeEvent(conn *websocket.Conn, room *models.Room, playerID string, event models.Event, open bool) bool {
+	if !open {
+		// The room was closed, removed the player, or evicted us for falling
+		// behind
+		message := websocket.FormatCloseMessage(closeSlowConsumer, "too many missed events, resync required")
+		if room.Closed() {
+			message = websocket.FormatCloseMessage(websocket.CloseGoingAway, "room closed")
+		} else if _, exists := room.Snapshot().Players[playerID]; !exists {
+			message = websocket.FormatCloseMessage(closeRemoved, "removed from room")
+		}
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		return false
+	}
+
+	return conn.WriteJSON(event) == nil
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionTokenIgnoresQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		prepare func(r *http.Request)
+		want    string
+	}{
+		{"query", func(r *http.Request) {}, ""},
+		{"bearer", func(r *http.Request) { r.Header.Set("Authorization", "Bearer header") }, "header"},
+		{"header", func(r *http.Request) { r.Header.Set(sessionHeader, "header") }, "header"},
+		{"cookie", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: sessionCookie, Value: "cookie"}) }, "cookie"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/api/rooms/room/ws?token=query", nil)
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Upgrade", "websocket")
+		test.prepare(request)
+
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = request
+
+		if token := sessionToken(c); token != test.want {
+			t.Errorf("%s: token = %q, want %q", test.name, token, test.want)
+		}
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	if checkOrigin(nil) != nil {
+		t.Error("no configured origin should leave the same-origin check of the upgrader")
+	}
+
+	check := checkOrigin([]string{"https://poker.example.com"})
+	for origin, want := range map[string]bool{
+		"https://poker.example.com": true,
+		"https://POKER.example.com": true,
+		"https://evil.example.com":  false,
+		"":                          false,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/api/rooms/room/ws", nil)
+		request.Header.Set("Origin", origin)
+		if got := check(request); got != want {
+			t.Errorf("origin %q allowed = %v, want %v", origin, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arvi89/poker-go/models"
+	"github.com/gorilla/websocket"
+)
+
+// Drain refuses new rooms and real-time connections, so that the server
+// reports itself as not ready while existing clients are still served
+func (h *RoomHandler) Drain() {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+
+	h.draining = true
+}
+
+// Shutdown drains the handler before the server stops: new rooms and
+// real-time connections are refused, every client is told to reconnect after
+// the given delay, and open WebSocket and event stream connections are
+// closed. It waits for them to end until the context is done.
+func (h *RoomHandler) Shutdown(ctx context.Context, reconnectAfter time.Duration) error {
+	h.Drain()
+
+	h.shutdownOnce.Do(func() {
+		h.drainMutex.Lock()
+		h.reconnectAfter = reconnectAfter
+		h.drainMutex.Unlock()
+
+		for _, room := range h.store.Rooms() {
+			room.AnnounceShutdown(reconnectAfter)
+		}
+		close(h.shutdown)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		h.streams.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Draining reports whether the handler is shutting down, refusing new rooms
+// and real-time connections
+func (h *RoomHandler) Draining() bool {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+
+	return h.draining
+}
+
+// trackStream registers a real-time connection for Shutdown to wait for, and
+// reports false if the handler is shutting down. Tracked connections must
+// call h.streams.Done once closed.
+func (h *RoomHandler) trackStream() bool {
+	h.drainMutex.Lock()
+	defer h.drainMutex.Unlock()
+
+	if h.draining {
+		return false
+	}
+
+	h.streams.Add(1)
+	return true
+}
+
+// closeForShutdown sends the events queued for a WebSocket client, including
+// the shutdown notice, then closes the connection telling the client the
+// server is restarting
+func closeForShutdown(conn *websocket.Conn, room *models.Room, playerID string, events chan models.Event) {
+	if !flushEvents(conn, room, playerID, events) {
+		return
+	}
+
+	message := websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server shutting down")
+	conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Arvi89/poker-go/metrics"
+	"github.com/Arvi89/poker-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+// EventStreamHandler streams room events with Server-Sent Events, for clients
+// that cannot use WebSockets. Each event is sent as a message whose data is
+// the same JSON as on the WebSocket, with the event's cursor as message ID so
+// that browsers resume from it when they reconnect.
+func (h *RoomHandler) EventStreamHandler(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	if !h.trackStream() {
+		errorResponse(c, models.ErrShuttingDown)
+		return
+	}
+	defer h.streams.Done()
+
+	if err := room.Connect(playerID); err != nil {
+		errorResponse(c, err)
+		return
+	}
+	defer room.Disconnect(playerID, h.reconnectGrace)
+
+	// Browsers send the ID of the last message they got when reconnecting
+	since := c.GetHeader("Last-Event-ID")
+	if since == "" {
+		since = c.Query("since")
+	}
+
+	events, backlog := subscribe(room, playerID, since)
+	defer room.Unsubscribe(events)
+
+	instance := room.Snapshot().Instance
+
+	metrics.EventStreams.Inc()
+	defer metrics.EventStreams.Dec()
+
+	logger := requestLogger(c).With("room", room.ID, "player", playerID)
+	connectedAt := time.Now()
+	logger.Info("Event stream opened")
+	defer func() {
+		logger.Info("Event stream closed", "duration", time.Since(connectedAt))
+	}()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, event := range backlog {
+		if err := writeServerSentEvent(c.Writer, instance, event); err != nil {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	// Keep proxies from closing an idle stream
+	ticker := time.NewTicker(h.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				// The room was closed or evicted us, the client reconnects
+				// and resyncs if it can
+				return
+			}
+			if err := writeServerSentEvent(c.Writer, instance, event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-h.shutdown:
+			h.closeEventStream(c.Writer, instance, events)
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+
+		c.Writer.Flush()
+	}
+}
+
+// closeEventStream sends the events already queued for an event stream
+// client, including the shutdown notice, and tells the browser when to
+// reconnect
+func (h *RoomHandler) closeEventStream(w gin.ResponseWriter, instance string, events chan models.Event) {
+	defer w.Flush()
+
+	for {
+		select {
+		case event, open := <-events:
+			if !open {
+				return
+			}
+			if err := writeServerSentEvent(w, instance, event); err != nil {
+				return
+			}
+		default:
+			h.drainMutex.Lock()
+			reconnectAfter := h.reconnectAfter
+			h.drainMutex.Unlock()
+
+			fmt.Fprintf(w, "retry: %d\n\n", reconnectAfter.Milliseconds())
+			return
+		}
+	}
+}
+
+// writeServerSentEvent writes an event in the Server-Sent Events format.
+// Transient events have no ID, so that clients resume after the last
+// numbered event.
+func writeServerSentEvent(w io.Writer, instance string, event models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if event.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s\n", formatCursor(instance, event.Seq)); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/Arvi89/poker-go/models"
+	"github.com/gin-gonic/gin"
+)
+
+// AddStory handles requests to add a story to the room backlog
+func (h *RoomHandler) AddStory(c *gin.Context) {
+	var req struct {
+		Title       string `json:"title" binding:"required"`
+		Description string `json:"description"`
+		Link        string `json:"link"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
+		return
+	}
+
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	story, err := room.AddStory(playerID, req.Title, req.Description, req.Link)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusCreated, "story_added", story, "")
+}
+
+// UpdateStory handles requests to edit a story of the room backlog
+func (h *RoomHandler) UpdateStory(c *gin.Context) {
+	var req models.StoryUpdate
+
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
+		return
+	}
+
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	story, err := room.UpdateStory(playerID, c.Param("storyId"), req)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "story_updated", story, "")
+}
+
+// DeleteStory handles requests to remove a story from the room backlog
+func (h *RoomHandler) DeleteStory(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	if err := room.DeleteStory(playerID, c.Param("storyId")); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "story_deleted", nil, "")
+}
+
+// ReorderStories handles requests to change the order of the room backlog
+func (h *RoomHandler) ReorderStories(c *gin.Context) {
+	var req struct {
+		StoryIDs []string `json:"storyIds" binding:"required"`
+	}
+
+	if err := c.BindJSON(&req); err != nil {
+		standardResponse(c, http.StatusBadRequest, "error", nil, "Invalid request format")
+		return
+	}
+
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	if err := room.ReorderStories(playerID, req.StoryIDs); err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "stories_reordered", nil, "")
+}
+
+// NextStory handles requests to start estimating the next pending story
+func (h *RoomHandler) NextStory(c *gin.Context) {
+	room, playerID, ok := h.authenticate(c)
+	if !ok {
+		return
+	}
+
+	story, err := room.NextStory(playerID)
+	if err != nil {
+		errorResponse(c, err)
+		return
+	}
+
+	// A nil story means the backlog is done
+	if story == nil {
+		standardResponse(c, http.StatusOK, "backlog_finished", nil, "")
+		return
+	}
+
+	standardResponse(c, http.StatusOK, "story_started", story, "")
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the media type of the Prometheus text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WriteText writes the registered metrics in the Prometheus text format
+func WriteText(w io.Writer) error {
+	registryMutex.Lock()
+	metrics := append([]metric(nil), registry...)
+	registryMutex.Unlock()
+
+	buffer := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(buffer, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(buffer, "# TYPE %s %s\n", m.name, m.kind)
+
+		switch value := m.value.(type) {
+		case *Counter:
+			fmt.Fprintf(buffer, "%s %d\n", m.name, value.Value())
+		case *Gauge:
+			fmt.Fprintf(buffer, "%s %d\n", m.name, value.Value())
+		case GaugeFunc:
+			fmt.Fprintf(buffer, "%s %s\n", m.name, formatFloat(value()))
+		case *HistogramVec:
+			writeHistogram(buffer, m.name, value)
+		}
+	}
+
+	return buffer.Flush()
+}
+
+// writeHistogram writes the series of a histogram, with cumulative buckets
+func writeHistogram(w io.Writer, name string, h *HistogramVec) {
+	for _, series := range h.snapshot() {
+		labels := make([]string, len(h.labels))
+		for i, label := range h.labels {
+			labels[i] = label + "=" + quoteLabel(series.labelValues[i])
+		}
+		prefix := strings.Join(labels, ",")
+		if prefix != "" {
+			prefix += ","
+		}
+
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", name, prefix, formatFloat(bound), series.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, series.count)
+
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, strings.TrimSuffix(prefix, ","), formatFloat(series.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, strings.TrimSuffix(prefix, ","), series.count)
+	}
+}
+
+// formatFloat formats a sample value
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+// escapeHelp escapes a help text
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// quoteLabel quotes and escapes a label value
+func quoteLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
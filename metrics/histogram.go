@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets used to
+// measure request durations
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// HistogramVec counts observations in buckets, separately for each
+// combination of label values
+type HistogramVec struct {
+	buckets []float64
+	labels  []string
+
+	mutex  sync.Mutex
+	series map[string]*histogram
+}
+
+// histogram holds the observations of one combination of label values
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewHistogramVec creates and registers a histogram with the given bucket
+// upper bounds and label names
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	vec := &HistogramVec{
+		buckets: buckets,
+		labels:  labels,
+		series:  make(map[string]*histogram),
+	}
+	register(name, help, "histogram", vec)
+
+	return vec
+}
+
+// Observe records a value for the given label values, in the order of the
+// label names
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	series, exists := h.series[key]
+	if !exists {
+		series = &histogram{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = series
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+// snapshot returns a copy of every series, sorted by label values
+func (h *HistogramVec) snapshot() []histogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	series := make([]histogram, 0, len(h.series))
+	for _, s := range h.series {
+		copied := *s
+		copied.counts = append([]uint64(nil), s.counts...)
+		series = append(series, copied)
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return strings.Join(series[i].labelValues, "\xff") < strings.Join(series[j].labelValues, "\xff")
+	})
+
+	return series
+}
@@ -0,0 +1,142 @@
+// Package metrics holds the counters describing the health of the server and
+// exposes them in the Prometheus text format
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value safe for concurrent use
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+// Add increments the counter by the given amount
+func (c *Counter) Add(delta uint64) {
+	c.value.Add(delta)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() uint64 {
+	return c.value.Load()
+}
+
+// Gauge is a value that can go up and down, safe for concurrent use
+type Gauge struct {
+	value atomic.Int64
+}
+
+// Inc increments the gauge by one
+func (g *Gauge) Inc() {
+	g.value.Add(1)
+}
+
+// Dec decrements the gauge by one
+func (g *Gauge) Dec() {
+	g.value.Add(-1)
+}
+
+// Set replaces the value of the gauge
+func (g *Gauge) Set(value int64) {
+	g.value.Store(value)
+}
+
+// Value returns the current value of the gauge
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+// GaugeFunc is a gauge whose value is computed when metrics are collected
+type GaugeFunc func() float64
+
+// metric is a registered metric
+type metric struct {
+	name  string
+	help  string
+	kind  string
+	value interface{}
+}
+
+var (
+	registryMutex sync.Mutex
+	registry      []metric
+)
+
+// register adds a metric to those exposed by WriteText
+func register(name, help, kind string, value interface{}) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry = append(registry, metric{name: name, help: help, kind: kind, value: value})
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string) *Counter {
+	counter := &Counter{}
+	register(name, help, "counter", counter)
+
+	return counter
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name, help string) *Gauge {
+	gauge := &Gauge{}
+	register(name, help, "gauge", gauge)
+
+	return gauge
+}
+
+// RegisterGaugeFunc registers a gauge computed by fn when metrics are
+// collected
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	register(name, help, "gauge", GaugeFunc(fn))
+}
+
+// Server-wide metrics
+var (
+	// EventsBroadcast counts events sent to the clients of this instance
+	EventsBroadcast = NewCounter("poker_events_broadcast_total", "Room events sent to clients.")
+
+	// EventsDropped counts events that could not be delivered to a subscriber
+	// whose buffer was full
+	EventsDropped = NewCounter("poker_events_dropped_total", "Room events dropped for slow clients.")
+
+	// SubscribersEvicted counts subscribers disconnected for falling too far
+	// behind
+	SubscribersEvicted = NewCounter("poker_subscribers_evicted_total", "Clients disconnected for missing too many events.")
+
+	// VotesSubmitted counts votes cast by players
+	VotesSubmitted = NewCounter("poker_votes_submitted_total", "Votes submitted by players.")
+
+	// Reveals counts rounds whose cards were revealed, manually or not
+	Reveals = NewCounter("poker_reveals_total", "Rounds whose cards were revealed.")
+
+	// Resets counts rounds reset by a facilitator
+	Resets = NewCounter("poker_resets_total", "Rounds reset by a facilitator.")
+
+	// RoomsCleanedUp counts empty rooms removed by the periodic cleanup
+	RoomsCleanedUp = NewCounter("poker_rooms_cleaned_up_total", "Empty rooms removed by the cleanup.")
+
+	// RoomsExpired counts rooms removed for being idle or open too long
+	RoomsExpired = NewCounter("poker_rooms_expired_total", "Rooms removed for being idle or open too long.")
+
+	// WebSocketConnections is the number of open WebSocket connections
+	WebSocketConnections = NewGauge("poker_websocket_connections", "Open WebSocket connections.")
+
+	// EventStreams is the number of open Server-Sent Events streams
+	EventStreams = NewGauge("poker_event_streams", "Open Server-Sent Events streams.")
+
+	// HTTPRequestDuration measures the time taken to serve HTTP requests
+	HTTPRequestDuration = NewHistogramVec(
+		"poker_http_request_duration_seconds",
+		"Time taken to serve HTTP requests.",
+		DefaultBuckets,
+		"method", "route", "status",
+	)
+)
@@ -0,0 +1,145 @@
+package models
+
+import "encoding/json"
+
+// start launches the goroutine owning the room state. Every access to the
+// state goes through it, so that callers never need to lock the room.
+func (r *Room) start() {
+	r.commands = make(chan func())
+	r.closed = make(chan struct{})
+	r.stopped = make(chan struct{})
+	r.snapshot.Store(r.view())
+
+	go r.run()
+}
+
+// run applies the commands sent to the room one at a time until the room is
+// closed, publishing a new snapshot after each command that changed it
+func (r *Room) run() {
+	for {
+		select {
+		case command := <-r.commands:
+			command()
+
+			if r.dirty {
+				r.snapshot.Store(r.view())
+				r.dirty = false
+			}
+		case <-r.closed:
+			r.shutdown()
+			close(r.stopped)
+			return
+		}
+	}
+}
+
+// do runs fn on the room's goroutine, committing its changes, and waits for
+// it to complete. It reports false, without running fn, if the room is
+// closed, or if the changes of fn could not be committed. A panic in fn is
+// raised again in the caller's goroutine.
+func (r *Room) do(fn func()) bool {
+	done := make(chan struct{})
+	var recovered interface{}
+	committed := false
+
+	command := func() {
+		defer close(done)
+		defer func() {
+			recovered = recover()
+		}()
+
+		committed = r.transact(fn)
+	}
+
+	select {
+	case r.commands <- command:
+	case <-r.closed:
+		return false
+	}
+
+	<-done
+	if recovered != nil {
+		panic(recovered)
+	}
+
+	return committed
+}
+
+// call runs fn on the room's goroutine and returns its result, or closed if
+// the room is closed or the changes of fn could not be committed
+func call[T any](r *Room, closed T, fn func() T) T {
+	var result T
+	if !r.do(func() { result = fn() }) {
+		return closed
+	}
+
+	return result
+}
+
+// callErr runs fn on the room's goroutine and returns its results, or
+// ErrRoomNotFound if the room is closed or the changes of fn could not be
+// committed
+func callErr[T any](r *Room, fn func() (T, error)) (T, error) {
+	var result T
+	var err error
+	if !r.do(func() { result, err = fn() }) {
+		var zero T
+		return zero, ErrRoomNotFound
+	}
+
+	return result, err
+}
+
+// Close stops the room: pending timers are cancelled, subscribers are
+// disconnected and later calls have no effect
+func (r *Room) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+	})
+}
+
+// Stopped returns a channel closed once a closed room has stopped its timers
+// and disconnected its subscribers, after which its state no longer changes
+func (r *Room) Stopped() <-chan struct{} {
+	return r.stopped
+}
+
+// Closed reports whether the room was closed
+func (r *Room) Closed() bool {
+	select {
+	case <-r.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// State returns the serialized state of the room, as passed to the change
+// handler
+func (r *Room) State() ([]byte, error) {
+	return callErr(r, func() ([]byte, error) {
+		return json.Marshal(r)
+	})
+}
+
+// Snapshot returns the latest state of the room, with every vote visible.
+// It must not be modified.
+func (r *Room) Snapshot() *RoomView {
+	return r.snapshot.Load()
+}
+
+// shutdown releases the timers and subscribers of a closed room. It must run
+// on the room's goroutine.
+func (r *Room) shutdown() {
+	r.stopAutoReveal()
+	r.stopTimer()
+
+	for playerID, timer := range r.removalTimers {
+		timer.Stop()
+		delete(r.removalTimers, playerID)
+	}
+
+	for client := range r.Clients {
+		r.unsubscribe(client)
+	}
+}
@@ -2,15 +2,34 @@ package models
 
 // Event types
 const (
-	EventTypeInitialState       = "initial_state"
-	EventTypePlayerJoined       = "player_joined"
-	EventTypePlayerLeft         = "player_left"
-	EventTypeVoteSubmitted      = "vote_submitted"
-	EventTypeCardsRevealed      = "cards_revealed"
-	EventTypeVotingReset        = "voting_reset"
-	EventTypeLinkUpdated        = "link_updated"
-	EventTypeCreatorChanged     = "creator_changed"
-	EventTypeCreatorTransferred = "creator_transferred"
+	EventTypeInitialState        = "initial_state"
+	EventTypePlayerJoined        = "player_joined"
+	EventTypePlayerLeft          = "player_left"
+	EventTypeVoteSubmitted       = "vote_submitted"
+	EventTypeCardsRevealed       = "cards_revealed"
+	EventTypeVotingReset         = "voting_reset"
+	EventTypeLinkUpdated         = "link_updated"
+	EventTypeCreatorChanged      = "creator_changed"
+	EventTypeCreatorTransferred  = "creator_transferred"
+	EventTypeStoriesUpdated      = "stories_updated"
+	EventTypeStoryStarted        = "story_started"
+	EventTypeEstimateAccepted    = "estimate_accepted"
+	EventTypeSettingsUpdated     = "settings_updated"
+	EventTypeAutoRevealScheduled = "auto_reveal_scheduled"
+	EventTypeAutoRevealCancelled = "auto_reveal_cancelled"
+	EventTypeCardsAutoRevealed   = "cards_auto_revealed"
+	EventTypeTimerStarted        = "timer_started"
+	EventTypeTimerTick           = "timer_tick"
+	EventTypeTimerExpired        = "timer_expired"
+	EventTypeTimerCancelled      = "timer_cancelled"
+	EventTypeRoleChanged         = "role_changed"
+	EventTypePresenceChanged     = "presence_changed"
+	EventTypeRoomSynced          = "room_synced"
+	EventTypeRoomExpiring        = "room_expiring"
+	EventTypeRoomExpired         = "room_expired"
+	EventTypeServerShutdown      = "server_shutdown"
+	EventTypeRoomClosed          = "room_closed"
+	EventTypePlayerKicked        = "player_kicked"
 )
 
 // Card represents a planning poker card value
@@ -33,6 +52,9 @@ const (
 	Coffee   Card = "coffee"
 )
 
+// Hidden is shown in place of another player's card until cards are revealed
+const Hidden Card = "hidden"
+
 // Possible voting statuses
 const (
 	StatusVoting   = "voting"
@@ -0,0 +1,144 @@
+package models
+
+import (
+	"math"
+	"strconv"
+)
+
+// Built-in deck presets
+const (
+	DeckModifiedFibonacci = "modified_fibonacci"
+	DeckFibonacci         = "fibonacci"
+	DeckPowersOfTwo       = "powers_of_two"
+	DeckTShirt            = "tshirt"
+	DeckHours             = "hours"
+	DeckCustom            = "custom"
+)
+
+// Deck limits
+const (
+	maxDeckCards    = 30
+	maxCardValueLen = 16
+)
+
+// DeckCard is a card players can vote with
+type DeckCard struct {
+	Value   Card     `json:"value"`
+	Label   string   `json:"label,omitempty"`
+	Numeric *float64 `json:"numeric,omitempty"`
+}
+
+// Deck is the set of cards available in a room
+type Deck struct {
+	Name  string     `json:"name"`
+	Cards []DeckCard `json:"cards"`
+}
+
+// presetDecks lists the card values of the built-in decks
+var presetDecks = map[string][]Card{
+	DeckModifiedFibonacci: {Zero, One, Two, Three, Five, Eight, Thirteen, Twenty, Forty, Hundred, Question, Coffee},
+	DeckFibonacci:         {Zero, One, Two, Three, Five, Eight, Thirteen, "21", "34", "55", "89", Question, Coffee},
+	DeckPowersOfTwo:       {Zero, One, Two, "4", Eight, "16", "32", "64", Question, Coffee},
+	DeckTShirt:            {"XS", "S", "M", "L", "XL", "XXL", Question, Coffee},
+	DeckHours:             {Zero, "0.5", One, Two, "4", Eight, "16", "24", Forty, Question, Coffee},
+}
+
+// DefaultDeck returns the deck used when none is specified
+func DefaultDeck() Deck {
+	deck, _ := PresetDeck(DeckModifiedFibonacci)
+	return deck
+}
+
+// PresetDeck returns a built-in deck by name
+func PresetDeck(name string) (Deck, bool) {
+	values, exists := presetDecks[name]
+	if !exists {
+		return Deck{}, false
+	}
+
+	cards := make([]DeckCard, len(values))
+	for i, value := range values {
+		cards[i] = DeckCard{Value: value}
+	}
+
+	deck := Deck{Name: name, Cards: cards}
+	deck.normalize()
+
+	return deck, true
+}
+
+// PresetDecks returns all built-in decks
+func PresetDecks() []Deck {
+	names := []string{DeckModifiedFibonacci, DeckFibonacci, DeckPowersOfTwo, DeckTShirt, DeckHours}
+
+	decks := make([]Deck, 0, len(names))
+	for _, name := range names {
+		deck, _ := PresetDeck(name)
+		decks = append(decks, deck)
+	}
+
+	return decks
+}
+
+// NewCustomDeck creates a deck from a custom list of cards. Cards without an
+// explicit numeric value get one if their value is a number.
+func NewCustomDeck(cards []DeckCard) (Deck, error) {
+	if len(cards) == 0 || len(cards) > maxDeckCards {
+		return Deck{}, ErrInvalidDeck
+	}
+
+	seen := make(map[Card]bool, len(cards))
+	for _, card := range cards {
+		if card.Value == "" || len(card.Value) > maxCardValueLen {
+			return Deck{}, ErrInvalidDeck
+		}
+		if card.Value == Unknown || card.Value == Hidden || seen[card.Value] {
+			return Deck{}, ErrInvalidDeck
+		}
+		seen[card.Value] = true
+	}
+
+	deck := Deck{
+		Name:  DeckCustom,
+		Cards: append([]DeckCard(nil), cards...),
+	}
+	deck.normalize()
+
+	return deck, nil
+}
+
+// Contains reports whether a card belongs to the deck
+func (d Deck) Contains(card Card) bool {
+	for _, c := range d.Cards {
+		if c.Value == card {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NumericValue returns the numeric value of a card, if it has one
+func (d Deck) NumericValue(card Card) (float64, bool) {
+	for _, c := range d.Cards {
+		if c.Value == card && c.Numeric != nil {
+			return *c.Numeric, true
+		}
+	}
+
+	return 0, false
+}
+
+// normalize fills in numeric values for cards whose value is a number
+func (d *Deck) normalize() {
+	for i, card := range d.Cards {
+		if card.Numeric != nil {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(string(card.Value), 64)
+		if err == nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+			d.Cards[i].Numeric = &value
+		}
+	}
+}
@@ -4,10 +4,27 @@ import "errors"
 
 // Common errors
 var (
-	ErrPlayerNotFound    = errors.New("player not found in room")
-	ErrPlayerExists      = errors.New("player already exists in room")
-	ErrNotCreator        = errors.New("only the room creator can perform this action")
-	ErrInvalidCard       = errors.New("invalid card value")
-	ErrRoomNotFound      = errors.New("room not found")
-	ErrInvalidPlayerName = errors.New("invalid player name")
+	ErrPlayerNotFound     = errors.New("player not found in room")
+	ErrPlayerExists       = errors.New("player already exists in room")
+	ErrNotCreator         = errors.New("only the room creator or a facilitator can perform this action")
+	ErrInvalidCard        = errors.New("invalid card value")
+	ErrRoomNotFound       = errors.New("room not found")
+	ErrInvalidPlayerName  = errors.New("invalid player name")
+	ErrInvalidSession     = errors.New("invalid or missing session token")
+	ErrInvalidDeck        = errors.New("invalid card deck")
+	ErrStoryNotFound      = errors.New("story not found in room")
+	ErrInvalidStory       = errors.New("invalid story")
+	ErrInvalidOrder       = errors.New("story order must list every story exactly once")
+	ErrNoPendingStory     = errors.New("no pending story to estimate")
+	ErrNotRevealed        = errors.New("cards have not been revealed")
+	ErrInvalidSettings    = errors.New("invalid room settings")
+	ErrInvalidTimer       = errors.New("invalid timer duration or action")
+	ErrNoTimer            = errors.New("no timer is running")
+	ErrNotVoting          = errors.New("voting is not in progress")
+	ErrVotingLocked       = errors.New("voting is locked")
+	ErrInvalidRole        = errors.New("invalid player role")
+	ErrObserverCannotVote = errors.New("observers cannot vote")
+	ErrCreatorRole        = errors.New("only the room creator can change their own role")
+	ErrShuttingDown       = errors.New("server is shutting down")
+	ErrInvalidAPIKey      = errors.New("invalid or missing API key")
 )
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Arvi89/poker-go/metrics"
+)
+
+// Event delivery limits
+const (
+	// eventBufferSize is the number of recent events kept per room for
+	// clients catching up after a reconnection
+	eventBufferSize = 256
+
+	// maxDroppedEvents is the number of consecutive events a subscriber may
+	// miss before it is disconnected
+	maxDroppedEvents = 5
+)
+
+// eventLog is a ring buffer of the most recent sequenced events of a room
+type eventLog struct {
+	events []Event
+	next   int
+}
+
+// add records an event, overwriting the oldest one once the buffer is full
+func (l *eventLog) add(event Event) {
+	if len(l.events) < eventBufferSize {
+		l.events = append(l.events, event)
+		return
+	}
+
+	l.events[l.next] = event
+	l.next = (l.next + 1) % eventBufferSize
+}
+
+// since returns the recorded events following the given sequence number, in
+// order. It reports false if some of them are no longer buffered.
+func (l *eventLog) since(seq uint64) ([]Event, bool) {
+	ordered := append(append(make([]Event, 0, len(l.events)), l.events[l.next:]...), l.events[:l.next]...)
+
+	for i, event := range ordered {
+		if event.Seq > seq {
+			// The event right after seq must still be in the buffer
+			return ordered[i:], event.Seq == seq+1
+		}
+	}
+
+	return nil, true
+}
+
+// Resume registers a client that was previously connected and returns the
+// events it missed since the given sequence number, projected for the viewer.
+// Sequence numbers are specific to each instance sharing the room, so the
+// client gives the instance it was connected to, if known. It reports false
+// if those events are no longer available, in which case the client needs a
+// full snapshot of the room instead.
+func (r *Room) Resume(viewerID, instance string, since uint64) (eventChan chan Event, missed []Event, resumed bool) {
+	closed := !r.do(func() {
+		eventChan = r.subscribe(viewerID)
+
+		switch {
+		case instance != "" && instance != r.instance:
+			return
+		case since > r.Seq:
+			return
+		case r.events == nil:
+			// A restored room has no buffered events to replay
+			resumed = since == r.Seq
+			return
+		}
+
+		missed, resumed = r.events.since(since)
+		if !resumed {
+			missed = nil
+			return
+		}
+
+		for i, event := range missed {
+			if projected, isViewerPayload := event.Payload.(viewerPayload); isViewerPayload {
+				missed[i].Payload = projected.forViewer(viewerID)
+			}
+		}
+	})
+	if closed {
+		return closedEvents(), nil, false
+	}
+
+	return eventChan, missed, resumed
+}
+
+// broadcastTransient sends an event that is not worth replaying, such as a
+// timer tick, to all subscribed clients without giving it a sequence number. It
+// must run on the room's goroutine.
+func (r *Room) broadcastTransient(event Event) {
+	r.send(event)
+	r.publishEvent(event, true)
+}
+
+// AnnounceShutdown tells the clients of this instance that it is shutting
+// down and that they should reconnect after the given delay. Unlike other
+// events, the notice is never dropped for clients that fall behind.
+func (r *Room) AnnounceShutdown(reconnectAfter time.Duration) {
+	r.do(func() {
+		event := Event{
+			Type: EventTypeServerShutdown,
+			Payload: map[string]interface{}{
+				"reconnectAfter": int(reconnectAfter.Seconds()),
+			},
+		}
+
+		r.afterCommit(func() {
+			r.record(&event)
+			metrics.EventsBroadcast.Inc()
+			for client := range r.Clients {
+				forceSend(client, event)
+			}
+		})
+	})
+}
+
+// forceSend sends an event to a client, dropping the oldest events queued for
+// it to make room if needed. The client notices the gap in sequence numbers
+// and resyncs. It must run on the room's goroutine, the only sender.
+func forceSend(client chan Event, event Event) {
+	for {
+		select {
+		case client <- event:
+			return
+		default:
+		}
+
+		select {
+		case <-client:
+			metrics.EventsDropped.Inc()
+		default:
+		}
+	}
+}
+
+// AnnounceClosure tells the clients of the room, on every instance, that an
+// operator is closing it for the given reason
+func (r *Room) AnnounceClosure(reason string) {
+	r.do(func() {
+		r.broadcastEvent(Event{
+			Type:    EventTypeRoomClosed,
+			Payload: map[string]string{"reason": reason},
+		})
+		r.logger().Info("Room closed by an operator", "reason", reason)
+	})
+}
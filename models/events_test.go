@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShutdownNoticeReachesClientsBehind(t *testing.T) {
+	room, creatorID := newTestRoom(t)
+	events := room.Subscribe(creatorID)
+
+	// Fill the queue of the client without reading it
+	for len(events) < cap(events) {
+		if err := room.ResetVoting(creatorID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	room.AnnounceShutdown(5 * time.Second)
+
+	var last Event
+	for len(events) > 0 {
+		last = <-events
+	}
+	if last.Type != EventTypeServerShutdown {
+		t.Errorf("last event = %s, want %s", last.Type, EventTypeServerShutdown)
+	}
+}
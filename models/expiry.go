@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+// Reasons for a room to expire
+const (
+	ExpiryIdle     = "idle"
+	ExpiryLifetime = "lifetime"
+)
+
+// Expiry configures when rooms are removed. A zero duration disables the
+// corresponding limit.
+type Expiry struct {
+	// IdleTTL is how long a room is kept without any activity
+	IdleTTL time.Duration
+	// MaxLifetime is how long a room is kept after its creation, active or not
+	MaxLifetime time.Duration
+	// Warning is how long before expiring clients are warned
+	Warning time.Duration
+}
+
+// CheckExpiry reports whether the room has expired at the given time, in
+// which case its clients are told and it should be removed. Clients are
+// warned once when the room is about to expire; any activity postpones
+// idle expiry and lets them be warned again.
+func (r *Room) CheckExpiry(expiry Expiry, now time.Time) bool {
+	return call(r, false, func() bool {
+		expiresAt, reason := r.expiresAt(expiry)
+		if expiresAt.IsZero() {
+			return false
+		}
+
+		payload := map[string]interface{}{
+			"expiresAt": expiresAt,
+			"reason":    reason,
+		}
+
+		// Every instance sharing the room checks it and tells its own clients
+		switch {
+		case !now.Before(expiresAt):
+			r.deliver(Event{Type: EventTypeRoomExpired, Payload: payload})
+			return true
+		case expiresAt.Sub(now) <= expiry.Warning && !r.expiryWarned.Equal(expiresAt):
+			r.expiryWarned = expiresAt
+			r.deliver(Event{Type: EventTypeRoomExpiring, Payload: payload})
+		}
+
+		return false
+	})
+}
+
+// expiresAt returns when the room expires and why, or the zero time if it
+// never does. It must run on the room's goroutine.
+func (r *Room) expiresAt(expiry Expiry) (time.Time, string) {
+	var expiresAt time.Time
+	var reason string
+
+	if expiry.IdleTTL > 0 {
+		expiresAt, reason = r.LastActivity.Add(expiry.IdleTTL), ExpiryIdle
+	}
+	if expiry.MaxLifetime > 0 {
+		end := r.CreatedAt.Add(expiry.MaxLifetime)
+		if expiresAt.IsZero() || end.Before(expiresAt) {
+			expiresAt, reason = end, ExpiryLifetime
+		}
+	}
+
+	return expiresAt, reason
+}
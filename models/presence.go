@@ -0,0 +1,153 @@
+package models
+
+import "time"
+
+// Possible player presence states
+const (
+	PresenceConnected = "connected"
+	PresenceAway      = "away"
+)
+
+// Connect records a new live connection of a player, cancelling any pending
+// removal
+func (r *Room) Connect(playerID string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		player, exists := r.Players[playerID]
+		if !exists {
+			return ErrPlayerNotFound
+		}
+
+		if r.connections == nil {
+			r.connections = make(map[string]int)
+		}
+		r.connections[playerID]++
+
+		if timer, pending := r.removalTimers[playerID]; pending {
+			r.afterCommit(func() { timer.Stop() })
+			delete(r.removalTimers, playerID)
+		}
+
+		r.setPresence(player, PresenceConnected)
+
+		return nil
+	})
+}
+
+// Disconnect records the end of a player's connection. Once the player has no
+// connection left they are marked away, and removed from the room unless
+// they reconnect within the grace period.
+func (r *Room) Disconnect(playerID string, grace time.Duration) {
+	r.do(func() {
+		player, exists := r.Players[playerID]
+		if !exists {
+			return
+		}
+
+		if r.connections[playerID] == 0 {
+			return
+		}
+
+		r.connections[playerID]--
+		if r.connections[playerID] > 0 {
+			return
+		}
+		delete(r.connections, playerID)
+
+		r.setPresence(player, PresenceAway)
+		r.scheduleRemoval(playerID, grace)
+	})
+}
+
+// ScheduleRemovals schedules the removal of the players who are away without
+// a pending removal, such as the ones who left another instance before it
+// stopped, once the grace period since they were last seen is over
+func (r *Room) ScheduleRemovals(grace time.Duration) {
+	r.do(func() {
+		for playerID, player := range r.Players {
+			if _, pending := r.removalTimers[playerID]; pending || player.Presence != PresenceAway {
+				continue
+			}
+
+			r.scheduleRemoval(playerID, grace-time.Since(player.LastSeen))
+		}
+	})
+}
+
+// scheduleRemoval removes a player after the given delay unless they
+// reconnect meanwhile. It must run on the room's goroutine.
+func (r *Room) scheduleRemoval(playerID string, delay time.Duration) {
+	if r.removalTimers == nil {
+		r.removalTimers = make(map[string]*time.Timer)
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		r.do(func() {
+			// Ignore timers cancelled by a reconnection after firing
+			if r.removalTimers[playerID] != timer {
+				return
+			}
+			delete(r.removalTimers, playerID)
+
+			// The player may have reconnected to another instance
+			if player, exists := r.Players[playerID]; !exists || player.Presence != PresenceAway {
+				return
+			}
+
+			r.removePlayer(playerID)
+		})
+	})
+	r.removalTimers[playerID] = timer
+	r.onRollback(func() { timer.Stop() })
+}
+
+// setPresence updates the presence of a player and lets clients know. It must
+// run on the room's goroutine.
+func (r *Room) setPresence(player *Player, presence string) {
+	player.LastSeen = time.Now()
+	if player.Presence == presence {
+		return
+	}
+	player.Presence = presence
+
+	r.broadcastEvent(Event{
+		Type: EventTypePresenceChanged,
+		Payload: map[string]interface{}{
+			"playerId": player.ID,
+			"name":     player.Name,
+			"presence": presence,
+			"lastSeen": player.LastSeen,
+		},
+	})
+
+	r.notifyChange()
+	r.logger().Info("Presence changed", "player", player.ID, "presence", presence)
+}
+
+// forgetPresence drops the connection tracking of a removed player. It must run
+// on the room's goroutine.
+func (r *Room) forgetPresence(playerID string) {
+	delete(r.connections, playerID)
+
+	if timer, pending := r.removalTimers[playerID]; pending {
+		r.afterCommit(func() { timer.Stop() })
+		delete(r.removalTimers, playerID)
+	}
+}
+
+// preferredCreator reports whether a player is a better candidate for the
+// creator role than the current one: connected players come first, then the
+// longest-standing ones
+func preferredCreator(candidate, current *Player) bool {
+	if current == nil {
+		return true
+	}
+
+	candidateConnected := candidate.Presence == PresenceConnected
+	currentConnected := current.Presence == PresenceConnected
+	if candidateConnected != currentConnected {
+		return candidateConnected
+	}
+
+	return candidate.JoinedAt.Before(current.JoinedAt)
+}
@@ -0,0 +1,244 @@
+package models
+
+import "encoding/json"
+
+// Publisher sends the changes of a room to the other instances sharing it
+type Publisher interface {
+	Publish(roomID string, data []byte) error
+}
+
+// replicationMessage is a change of a room sent between instances: an event
+// to deliver to their clients, the room state after a mutation, or the
+// deletion of the room
+type replicationMessage struct {
+	// Origin is the instance that sent the message
+	Origin string `json:"origin"`
+
+	Event   *remoteEvent    `json:"event,omitempty"`
+	State   json.RawMessage `json:"state,omitempty"`
+	Deleted bool            `json:"deleted,omitempty"`
+
+	// BaseVersion and BaseAuthor identify the state the mutation was applied to
+	BaseVersion uint64 `json:"baseVersion,omitempty"`
+	BaseAuthor  string `json:"baseAuthor,omitempty"`
+}
+
+// remoteEvent is an event broadcast by another instance
+type remoteEvent struct {
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	View      bool            `json:"view,omitempty"`
+	Transient bool            `json:"transient,omitempty"`
+}
+
+// DeletedMessage returns the message telling other instances that a room was
+// deleted
+func DeletedMessage(instance string) []byte {
+	data, _ := json.Marshal(replicationMessage{Origin: instance, Deleted: true})
+	return data
+}
+
+// SetPublisher shares the room with other instances: its events and state are
+// published after each change, tagged with the ID of this instance
+func (r *Room) SetPublisher(instance string, publisher Publisher) {
+	r.do(func() {
+		r.instance = instance
+		r.publisher = publisher
+		r.dirty = true
+	})
+}
+
+// ApplyRemote applies a message published by another instance for this room,
+// delivering its events to the local clients. Conflicting states are resolved
+// by keeping the latest version, and clients are sent the whole room when the
+// change did not apply to the state they know. It reports false if the room
+// was deleted or closed.
+func (r *Room) ApplyRemote(data []byte) bool {
+	var message replicationMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		r.logger().Error("Failed to decode message", "error", err)
+		return true
+	}
+
+	return call(r, false, func() bool {
+		if message.Origin == r.instance {
+			return true
+		}
+
+		switch {
+		case message.Deleted:
+			r.Close()
+			return false
+		case message.Event != nil:
+			r.applyRemoteEvent(message.Event)
+		case message.State != nil:
+			r.applyRemoteState(message, false)
+		}
+
+		return true
+	})
+}
+
+// Resync replaces the room with its shared state if that is newer, for
+// instances that may have missed messages. Clients are sent the whole room
+// if it changed.
+func (r *Room) Resync(state []byte) {
+	r.do(func() {
+		r.applyRemoteState(replicationMessage{State: state}, true)
+	})
+}
+
+// publishEvent sends an event to the other instances once the current command
+// is committed. It must run on the room's goroutine.
+func (r *Room) publishEvent(event Event, transient bool) {
+	if r.publisher == nil {
+		return
+	}
+
+	_, isView := event.Payload.(*RoomView)
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		r.logger().Error("Failed to encode event", "event", event.Type, "error", err)
+		return
+	}
+
+	message := replicationMessage{
+		Event: &remoteEvent{
+			Type:      event.Type,
+			Payload:   payload,
+			View:      isView,
+			Transient: transient,
+		},
+	}
+	r.afterCommit(func() {
+		r.publish(message)
+	})
+}
+
+// publish sends a message to the other instances. It must run on the room's
+// goroutine.
+func (r *Room) publish(message replicationMessage) {
+	message.Origin = r.instance
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		r.logger().Error("Failed to encode message", "error", err)
+		return
+	}
+
+	if err := r.publisher.Publish(r.ID, data); err != nil {
+		r.logger().Error("Failed to publish message", "error", err)
+	}
+}
+
+// applyRemoteEvent delivers an event of another instance to the local
+// clients, numbered in the sequence of this instance. It must run on the
+// room's goroutine.
+func (r *Room) applyRemoteEvent(remote *remoteEvent) {
+	event := Event{Type: remote.Type, Payload: remote.Payload}
+
+	if remote.View {
+		// Rebuild the room view so that votes are masked for each client
+		view := &RoomView{}
+		if err := json.Unmarshal(remote.Payload, view); err != nil {
+			r.logger().Error("Failed to decode event", "event", remote.Type, "error", err)
+			return
+		}
+		view.Seq = r.Seq
+		view.Instance = r.instance
+		event.Payload = view
+	}
+
+	if remote.Transient {
+		r.send(event)
+		return
+	}
+
+	r.deliver(event)
+}
+
+// applyRemoteState replaces the room state with the one of another instance
+// if it is newer. The connections, timers and subscribers of this instance
+// are kept. It must run on the room's goroutine.
+func (r *Room) applyRemoteState(message replicationMessage, resync bool) {
+	remote := &Room{}
+	if err := json.Unmarshal(message.State, remote); err != nil {
+		r.logger().Error("Failed to decode state", "error", err)
+		return
+	}
+
+	// Committed states have increasing versions. Ties only happen between
+	// changes that could not be committed, and go to the highest instance ID.
+	if remote.Version < r.Version || (remote.Version == r.Version && remote.Author <= r.Author) {
+		return
+	}
+	inSync := !resync && message.BaseVersion == r.Version && message.BaseAuthor == r.Author
+
+	r.replaceState(remote, !inSync)
+	r.reconnectLocalPlayers()
+}
+
+// replaceState replaces the shared state of the room with the given one,
+// sending it to the clients if notify is set. The connections, timers and
+// subscribers of this instance are kept. It must run on the room's goroutine.
+func (r *Room) replaceState(remote *Room, notify bool) {
+	previousTimer := r.Timer
+
+	r.Players = remote.Players
+	r.Status = remote.Status
+	r.CreatedAt = remote.CreatedAt
+	r.LastActivity = remote.LastActivity
+	r.VoteHistory = remote.VoteHistory
+	r.Link = remote.Link
+	r.Deck = remote.Deck
+	r.Settings = remote.Settings
+	r.Result = remote.Result
+	r.Estimate = remote.Estimate
+	r.Timer = remote.Timer
+	r.VotingLocked = remote.VotingLocked
+	r.Stories = remote.Stories
+	r.CurrentStoryID = remote.CurrentStoryID
+	r.Sessions = remote.Sessions
+	r.Version = remote.Version
+	r.Author = remote.Author
+	r.fillDefaults()
+	r.dirty = true
+
+	// Scheduled work belongs to the instance that scheduled it
+	if r.Timer == nil || previousTimer == nil || !r.Timer.EndsAt.Equal(previousTimer.EndsAt) {
+		r.stopTimer()
+	}
+	// The instance that changed the status told clients about it
+	if r.Status != StatusVoting {
+		r.stopAutoReveal()
+	}
+	for playerID, timer := range r.removalTimers {
+		if player, exists := r.Players[playerID]; !exists || player.Presence == PresenceConnected {
+			r.afterCommit(func() { timer.Stop() })
+			delete(r.removalTimers, playerID)
+		}
+	}
+
+	if notify {
+		r.deliver(Event{
+			Type:    EventTypeRoomSynced,
+			Payload: r.view(),
+		})
+	}
+}
+
+// reconnectLocalPlayers makes sure that players still connected to this
+// instance are not seen as away after the state was replaced, and forgets the
+// connections of removed ones. It must run on the room's goroutine.
+func (r *Room) reconnectLocalPlayers() {
+	for playerID := range r.connections {
+		player, exists := r.Players[playerID]
+		if !exists {
+			r.forgetPresence(playerID)
+			continue
+		}
+		if player.Presence != PresenceConnected {
+			r.setPresence(player, PresenceConnected)
+		}
+	}
+}
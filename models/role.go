@@ -0,0 +1,74 @@
+package models
+
+// Possible player roles
+const (
+	RoleVoter       = "voter"
+	RoleObserver    = "observer"
+	RoleFacilitator = "facilitator"
+)
+
+// validRole reports whether a role is one of the known roles
+func validRole(role string) bool {
+	return role == RoleVoter || role == RoleObserver || role == RoleFacilitator
+}
+
+// validJoinRole reports whether players may take a role when joining.
+// Facilitators are only appointed by the creator or another facilitator.
+func validJoinRole(role string) bool {
+	return role == RoleVoter || role == RoleObserver
+}
+
+// IsVoter reports whether the player takes part in votes
+func (p *Player) IsVoter() bool {
+	return p.Role != RoleObserver
+}
+
+// CanFacilitate reports whether the player may run the session
+func (p *Player) CanFacilitate() bool {
+	return p.IsCreator || p.Role == RoleFacilitator
+}
+
+// SetRole changes the role of a player. Players becoming observers lose their
+// vote for the current round. Only the creator may change their own role.
+func (r *Room) SetRole(initiatorID, playerID, role string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		if !validRole(role) {
+			return ErrInvalidRole
+		}
+
+		player, exists := r.Players[playerID]
+		if !exists {
+			return ErrPlayerNotFound
+		}
+
+		if player.IsCreator && initiatorID != playerID {
+			return ErrCreatorRole
+		}
+
+		player.Role = role
+		if !player.IsVoter() {
+			player.Card = Unknown
+		}
+
+		r.broadcastEvent(Event{
+			Type: EventTypeRoleChanged,
+			Payload: map[string]string{
+				"playerId": player.ID,
+				"name":     player.Name,
+				"role":     role,
+			},
+		})
+
+		// The remaining voters may all have voted
+		r.checkAutoReveal()
+
+		r.notifyChange()
+		r.logger().Info("Role changed", "player", initiatorID, "target", playerID, "role", role)
+
+		return nil
+	})
+}
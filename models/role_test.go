@@ -0,0 +1,68 @@
+package models
+
+import "testing"
+
+// newTestRoom creates a room, closed at the end of the test, and returns it
+// with the ID of its creator
+func newTestRoom(t *testing.T) (*Room, string) {
+	t.Helper()
+
+	room := NewRoom("alice", DefaultDeck())
+	t.Cleanup(room.Close)
+
+	for id := range room.Snapshot().Players {
+		return room, id
+	}
+
+	t.Fatal("room has no creator")
+	return nil, ""
+}
+
+func TestJoinRoles(t *testing.T) {
+	room, _ := newTestRoom(t)
+
+	tests := []struct {
+		role string
+		want error
+	}{
+		{RoleVoter, nil},
+		{RoleObserver, nil},
+		{RoleFacilitator, ErrInvalidRole},
+		{"admin", ErrInvalidRole},
+	}
+
+	for _, test := range tests {
+		if _, err := room.AddPlayer("player-"+test.role, test.role); err != test.want {
+			t.Errorf("joining as %s: error = %v, want %v", test.role, err, test.want)
+		}
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	room, creatorID := newTestRoom(t)
+
+	bobID, err := room.AddPlayer("bob", RoleVoter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carolID, err := room.AddPlayer("carol", RoleVoter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := room.SetRole(bobID, carolID, RoleFacilitator); err != ErrNotCreator {
+		t.Errorf("voter appointing a facilitator: error = %v, want %v", err, ErrNotCreator)
+	}
+	if err := room.SetRole(creatorID, bobID, RoleFacilitator); err != nil {
+		t.Fatalf("creator appointing a facilitator: %v", err)
+	}
+	if err := room.SetRole(bobID, carolID, RoleFacilitator); err != nil {
+		t.Errorf("facilitator appointing a facilitator: %v", err)
+	}
+	if err := room.SetRole(bobID, creatorID, RoleObserver); err != ErrCreatorRole {
+		t.Errorf("facilitator demoting the creator: error = %v, want %v", err, ErrCreatorRole)
+	}
+	if err := room.SetRole(creatorID, creatorID, RoleObserver); err != nil {
+		t.Errorf("creator changing their own role: %v", err)
+	}
+}
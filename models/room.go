@@ -1,23 +1,35 @@
 package models
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
 	"time"
 
+	"github.com/Arvi89/poker-go/metrics"
 	"github.com/google/uuid"
 )
 
-// NewRoom creates a new planning poker room
-func NewRoom(creatorName string) *Room {
+// NewRoom creates a new planning poker room using the given deck
+func NewRoom(creatorName string, deck Deck) *Room {
 	roomID := uuid.New().String()
+	now := time.Now()
 
 	room := &Room{
-		ID:          roomID,
-		Players:     make(map[string]*Player),
-		Status:      StatusVoting,
-		CreatedAt:   time.Now(),
-		VoteHistory: make([]VoteSession, 0),
-		Link:        "",
-		Clients:     make(map[chan Event]bool),
+		ID:           roomID,
+		Players:      make(map[string]*Player),
+		Status:       StatusVoting,
+		CreatedAt:    now,
+		LastActivity: now,
+		VoteHistory:  make([]VoteSession, 0),
+		Link:         "",
+		Deck:         deck,
+		Stories:      make([]*Story, 0),
+		Sessions:     make(map[string]string),
+		Clients:      make(map[chan Event]*Subscriber),
 	}
 
 	// Add the creator with a unique ID
@@ -26,55 +38,222 @@ func NewRoom(creatorName string) *Room {
 		ID:        creatorID,
 		Name:      creatorName,
 		Card:      Unknown,
+		Role:      RoleVoter,
 		IsCreator: true,
+		Presence:  PresenceAway,
 		JoinedAt:  time.Now(),
 	}
 
 	room.Players[creatorID] = creatorPlayer
+	room.start()
+
+	room.logger().Info("Room created", "player", creatorID, "deck", deck.Name)
 
 	return room
 }
 
-// AddPlayer adds a new player to the room
-func (r *Room) AddPlayer(name string) (string, bool) {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+// RestoreRoom rebuilds a room from its serialized state. Nobody is connected
+// to a freshly restored room, so every player is marked away.
+func RestoreRoom(data []byte) (*Room, error) {
+	return restoreRoom(data, false)
+}
+
+// RestoreReplica rebuilds a room shared with other instances from its
+// serialized state, keeping the presence of the players connected to them
+func RestoreReplica(data []byte) (*Room, error) {
+	return restoreRoom(data, true)
+}
+
+// restoreRoom rebuilds a room from its serialized state and starts it
+func restoreRoom(data []byte, keepPresence bool) (*Room, error) {
+	room := &Room{}
+	if err := json.Unmarshal(data, room); err != nil {
+		return nil, err
+	}
+
+	room.fillDefaults()
+	room.Clients = make(map[chan Event]*Subscriber)
+
+	if !keepPresence {
+		for _, player := range room.Players {
+			player.Presence = PresenceAway
+		}
+	}
+
+	room.start()
+
+	// Resume the countdown of a running round timer. The countdown of a
+	// replica belongs to the instance that started it.
+	if room.Timer != nil && !keepPresence {
+		room.do(room.armTimer)
+	}
+
+	return room, nil
+}
+
+// fillDefaults initializes the fields missing from a serialized state, such as
+// the ones added after it was saved
+func (r *Room) fillDefaults() {
+	if r.Players == nil {
+		r.Players = make(map[string]*Player)
+	}
+	if r.VoteHistory == nil {
+		r.VoteHistory = make([]VoteSession, 0)
+	}
+	if len(r.Deck.Cards) == 0 {
+		r.Deck = DefaultDeck()
+	}
+	if r.Stories == nil {
+		r.Stories = make([]*Story, 0)
+	}
+	if r.Sessions == nil {
+		r.Sessions = make(map[string]string)
+	}
+	if r.LastActivity.IsZero() {
+		r.LastActivity = r.CreatedAt
+	}
 
-	// Check if player name already exists
+	// Players saved before roles existed are voters
 	for _, player := range r.Players {
-		if player.Name == name {
-			return "", false
+		if player.Role == "" {
+			player.Role = RoleVoter
 		}
 	}
+}
 
-	// Generate a unique ID for the player
-	playerID := uuid.New().String()
+// SetChangeHandler registers a function called with the room state after each mutation
+func (r *Room) SetChangeHandler(fn ChangeFunc) {
+	r.do(func() {
+		r.onChange = fn
+	})
+}
 
-	// Create new player
-	player := &Player{
-		ID:        playerID,
-		Name:      name,
-		Card:      Unknown,
-		IsCreator: false,
-		JoinedAt:  time.Now(),
+// IssueToken creates a new secret session token for a player. Only a hash of
+// the token is kept on the room.
+func (r *Room) IssueToken(playerID string) (string, error) {
+	return callErr(r, func() (string, error) {
+		if _, exists := r.Players[playerID]; !exists {
+			return "", ErrPlayerNotFound
+		}
+
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return "", err
+		}
+		token := base64.RawURLEncoding.EncodeToString(secret)
+
+		r.Sessions[hashToken(token)] = playerID
+
+		r.notifyChange()
+
+		return token, nil
+	})
+}
+
+// Authenticate returns the ID of the player owning the given session token
+func (r *Room) Authenticate(token string) (string, bool) {
+	if token == "" {
+		return "", false
 	}
 
-	r.Players[playerID] = player
+	playerID := call(r, "", func() string {
+		playerID := r.Sessions[hashToken(token)]
+		if _, exists := r.Players[playerID]; !exists {
+			return ""
+		}
 
-	// Broadcast player joined event
-	r.broadcastEvent(Event{
-		Type:    EventTypePlayerJoined,
-		Payload: player,
+		return playerID
 	})
 
-	return playerID, true
+	return playerID, playerID != ""
+}
+
+// AddPlayer adds a new player with the given role to the room, either voter
+// or observer
+func (r *Room) AddPlayer(name, role string) (string, error) {
+	return callErr(r, func() (string, error) {
+		if !validJoinRole(role) {
+			return "", ErrInvalidRole
+		}
+
+		// Check if player name already exists
+		for _, player := range r.Players {
+			if player.Name == name {
+				return "", ErrPlayerExists
+			}
+		}
+
+		// Generate a unique ID for the player
+		playerID := uuid.New().String()
+
+		// Create new player
+		player := &Player{
+			ID:        playerID,
+			Name:      name,
+			Card:      Unknown,
+			Role:      role,
+			IsCreator: false,
+			Presence:  PresenceAway,
+			JoinedAt:  time.Now(),
+		}
+
+		r.Players[playerID] = player
+
+		// Broadcast player joined event
+		r.broadcastEvent(Event{
+			Type:    EventTypePlayerJoined,
+			Payload: newPlayerView(player),
+		})
+
+		r.notifyChange()
+		r.logger().Info("Player joined", "player", playerID, "role", role)
+
+		return playerID, nil
+	})
 }
 
 // RemovePlayer removes a player from the room
 func (r *Room) RemovePlayer(playerID string) bool {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+	return call(r, false, func() bool {
+		return r.removePlayer(playerID)
+	})
+}
+
+// KickPlayer removes a player from the room on behalf of an operator, telling
+// them before disconnecting their clients
+func (r *Room) KickPlayer(playerID string) bool {
+	return call(r, false, func() bool {
+		player, exists := r.Players[playerID]
+		if !exists {
+			return false
+		}
 
+		r.broadcastEvent(Event{
+			Type: EventTypePlayerKicked,
+			Payload: map[string]string{
+				"id":   playerID,
+				"name": player.Name,
+			},
+		})
+		r.logger().Info("Player kicked", "player", playerID)
+
+		r.removePlayer(playerID)
+
+		// The player's clients get the events queued so far, then their
+		// channel is closed
+		for client, subscriber := range r.Clients {
+			if subscriber.ViewerID == playerID {
+				r.unsubscribe(client)
+			}
+		}
+
+		return true
+	})
+}
+
+// removePlayer removes a player from the room. It must run on the room's
+// goroutine.
+func (r *Room) removePlayer(playerID string) bool {
 	player, exists := r.Players[playerID]
 	if !exists {
 		return false
@@ -85,21 +264,23 @@ func (r *Room) RemovePlayer(playerID string) bool {
 	wasCreator := player.IsCreator
 
 	delete(r.Players, playerID)
+	r.revokeSessions(playerID)
+	r.forgetPresence(playerID)
 
 	// If the player was a creator and there are other players, transfer creator rights
 	if wasCreator && len(r.Players) > 0 {
-		// Find another player to transfer creator rights to
+		// Prefer the longest-standing connected player
 		var newCreator *Player
-
-		// Pick the first available player
 		for _, p := range r.Players {
-			newCreator = p
-			break
+			if preferredCreator(p, newCreator) {
+				newCreator = p
+			}
 		}
 
 		// Set the new player as creator
 		if newCreator != nil {
 			newCreator.IsCreator = true
+			r.logger().Info("Creator changed", "player", newCreator.ID)
 
 			// Broadcast creator changed event
 			r.broadcastEvent(Event{
@@ -117,196 +298,458 @@ func (r *Room) RemovePlayer(playerID string) bool {
 		Payload: map[string]string{"name": playerName},
 	})
 
+	// The remaining players may all have voted
+	r.checkAutoReveal()
+
+	r.notifyChange()
+	r.logger().Info("Player left", "player", playerID)
+
 	return true
 }
 
 // SubmitVote submits a vote for a player
-func (r *Room) SubmitVote(playerID string, card Card) bool {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+func (r *Room) SubmitVote(playerID string, card Card) error {
+	return call(r, ErrRoomNotFound, func() error {
+		player, exists := r.Players[playerID]
+		if !exists {
+			return ErrPlayerNotFound
+		}
 
-	player, exists := r.Players[playerID]
-	if !exists {
-		return false
-	}
+		if !player.IsVoter() {
+			return ErrObserverCannotVote
+		}
 
-	player.Card = card
+		if !r.Deck.Contains(card) {
+			return ErrInvalidCard
+		}
 
-	// Broadcast vote submitted event (but not the actual vote)
-	r.broadcastEvent(Event{
-		Type: EventTypeVoteSubmitted,
-		Payload: map[string]string{
-			"name": player.Name,
-		},
-	})
+		if r.VotingLocked {
+			return ErrVotingLocked
+		}
 
-	return true
+		player.Card = card
+		r.afterCommit(metrics.VotesSubmitted.Inc)
+
+		// Broadcast vote submitted event (but not the actual vote)
+		r.broadcastEvent(Event{
+			Type: EventTypeVoteSubmitted,
+			Payload: map[string]string{
+				"name": player.Name,
+			},
+		})
+
+		r.checkAutoReveal()
+
+		r.notifyChange()
+		r.logger().Debug("Vote submitted", "player", playerID)
+
+		return nil
+	})
 }
 
 // RevealCards reveals all players' cards
-func (r *Room) RevealCards(initiatorID string) bool {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+func (r *Room) RevealCards(initiatorID string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
 
-	player, exists := r.Players[initiatorID]
-	if !exists || !player.IsCreator {
-		return false
-	}
+		r.reveal(EventTypeCardsRevealed)
 
-	r.Status = StatusRevealed
+		r.notifyChange()
+		r.logger().Info("Cards revealed", "player", initiatorID)
 
-	// Broadcast reveal event
-	r.broadcastEvent(Event{
-		Type:    EventTypeCardsRevealed,
-		Payload: r,
+		return nil
 	})
-
-	return true
 }
 
-// ResetVoting resets the voting session
-func (r *Room) ResetVoting(initiatorID string) bool {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+// ResetVoting resets the voting session. The link is cleared, unless a story
+// is being estimated: it then goes back to the link of the story.
+func (r *Room) ResetVoting(initiatorID string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
 
-	player, exists := r.Players[initiatorID]
-	if !exists || !player.IsCreator {
-		return false
-	}
+		// If currently revealed, save the current state to history before resetting
+		r.archiveRound()
+		r.resetRound()
+		r.afterCommit(metrics.Resets.Inc)
 
-	// If currently revealed, save the current state to history before resetting
-	if r.Status == StatusRevealed {
-		// Create a deep copy of the current players state
-		playersCopy := make(map[string]*Player)
-		for id, player := range r.Players {
-			playerCopy := *player // Create a copy of the player
-			playersCopy[id] = &playerCopy
+		// Reset the link, back to the one of the story being estimated if any
+		oldLink := r.Link
+		r.Link = ""
+		if story := r.currentStory(); story != nil {
+			r.Link = story.Link
 		}
 
-		// Add to history
-		voteSession := VoteSession{
-			Players:   playersCopy,
-			Timestamp: time.Now(),
-			Link:      r.Link,
+		// Broadcast reset event
+		r.broadcastEvent(Event{
+			Type:    EventTypeVotingReset,
+			Payload: r.view(),
+		})
+
+		// Also broadcast link update to ensure all clients update their link displays
+		if oldLink != r.Link {
+			r.broadcastEvent(Event{
+				Type:    EventTypeLinkUpdated,
+				Payload: map[string]string{"link": r.Link},
+			})
 		}
-		r.VoteHistory = append(r.VoteHistory, voteSession)
-	}
 
-	// Reset room state
-	r.Status = StatusVoting
+		r.notifyChange()
+		r.logger().Info("Voting reset", "player", initiatorID)
 
-	// Reset link
-	oldLink := r.Link
-	r.Link = ""
+		return nil
+	})
+}
 
-	// Reset all cards
-	for _, player := range r.Players {
-		player.Card = Unknown
-	}
+// SetEstimate records the estimate the team agreed on for the revealed round,
+// overriding the suggested card if needed
+func (r *Room) SetEstimate(initiatorID string, card Card) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
 
-	// Broadcast reset event
-	r.broadcastEvent(Event{
-		Type:    EventTypeVotingReset,
-		Payload: r,
+		if r.Status != StatusRevealed {
+			return ErrNotRevealed
+		}
+
+		if !r.Deck.Contains(card) {
+			return ErrInvalidCard
+		}
+
+		r.Estimate = card
+
+		r.broadcastEvent(Event{
+			Type: EventTypeEstimateAccepted,
+			Payload: map[string]interface{}{
+				"estimate": card,
+				"storyId":  r.CurrentStoryID,
+			},
+		})
+
+		r.notifyChange()
+		r.logger().Info("Estimate set", "player", initiatorID, "estimate", card)
+
+		return nil
 	})
+}
+
+// UpdateLink updates the room's link
+func (r *Room) UpdateLink(initiatorID string, link string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		// Update the link (including empty string to clear it)
+		r.Link = link
 
-	// Also broadcast link update to ensure all clients clear their link displays
-	if oldLink != "" {
+		// Broadcast link updated event
 		r.broadcastEvent(Event{
 			Type:    EventTypeLinkUpdated,
-			Payload: map[string]string{"link": ""},
+			Payload: map[string]string{"link": link},
 		})
-	}
 
-	return true
+		r.notifyChange()
+		r.logger().Info("Link updated", "player", initiatorID)
+
+		return nil
+	})
 }
 
-// UpdateLink updates the room's link
-func (r *Room) UpdateLink(initiatorID string, link string) bool {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+// TransferCreator transfers creator role from current creator to another player
+func (r *Room) TransferCreator(initiatorID string, newCreatorID string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		// Check if initiator is the current creator
+		initiator, exists := r.Players[initiatorID]
+		if !exists || !initiator.IsCreator {
+			return ErrNotCreator
+		}
 
-	player, exists := r.Players[initiatorID]
-	if !exists || !player.IsCreator {
-		return false
+		// Check if the target player exists
+		newCreator, exists := r.Players[newCreatorID]
+		if !exists {
+			return ErrPlayerNotFound
+		}
+
+		// Transfer creator role
+		initiator.IsCreator = false
+		newCreator.IsCreator = true
+
+		// Broadcast creator transferred event
+		r.broadcastEvent(Event{
+			Type: EventTypeCreatorTransferred,
+			Payload: map[string]interface{}{
+				"previousCreator": initiator.Name,
+				"newCreator":      newCreator.Name,
+			},
+		})
+
+		r.notifyChange()
+		r.logger().Info("Creator transferred", "player", initiatorID, "newCreator", newCreatorID)
+
+		return nil
+	})
+}
+
+// Subscribe registers a new client to receive events as seen by the given player
+func (r *Room) Subscribe(viewerID string) chan Event {
+	var eventChan chan Event
+	if !r.do(func() { eventChan = r.subscribe(viewerID) }) {
+		return closedEvents()
 	}
 
-	// Update the link (including empty string to clear it)
-	r.Link = link
+	return eventChan
+}
 
-	// Broadcast link updated event
-	r.broadcastEvent(Event{
-		Type:    EventTypeLinkUpdated,
-		Payload: map[string]string{"link": link},
+// subscribe registers a client channel. It must run on the room's goroutine.
+func (r *Room) subscribe(viewerID string) chan Event {
+	eventChan := make(chan Event, 10)
+	r.Clients[eventChan] = &Subscriber{ViewerID: viewerID}
+
+	return eventChan
+}
+
+// Unsubscribe removes a client from receiving events
+func (r *Room) Unsubscribe(eventChan chan Event) {
+	r.do(func() {
+		r.unsubscribe(eventChan)
 	})
+}
 
-	return true
+// closedEvents returns the channel given to clients subscribing to a closed
+// room, which delivers no events
+func closedEvents() chan Event {
+	eventChan := make(chan Event)
+	close(eventChan)
+
+	return eventChan
 }
 
-// TransferCreator transfers creator role from current creator to another player
-func (r *Room) TransferCreator(initiatorID string, newCreatorID string) bool {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+// unsubscribe removes a client and closes its channel, once the current
+// command is committed so that the client gets its events first. It must run
+// on the room's goroutine.
+func (r *Room) unsubscribe(eventChan chan Event) {
+	r.afterCommit(func() {
+		if _, exists := r.Clients[eventChan]; exists {
+			delete(r.Clients, eventChan)
+			close(eventChan)
+		}
+	})
+}
 
-	// Check if initiator is the current creator
-	initiator, exists := r.Players[initiatorID]
-	if !exists || !initiator.IsCreator {
-		return false
+// requireFacilitator checks that the initiator is the room creator or a
+// facilitator. It must run on the room's goroutine.
+func (r *Room) requireFacilitator(initiatorID string) error {
+	player, exists := r.Players[initiatorID]
+	if !exists || !player.CanFacilitate() {
+		return ErrNotCreator
 	}
 
-	// Check if the target player exists
-	newCreator, exists := r.Players[newCreatorID]
-	if !exists {
-		return false
+	return nil
+}
+
+// archiveRound saves the current round to history if its cards were revealed.
+// It must run on the room's goroutine.
+func (r *Room) archiveRound() {
+	if r.Status != StatusRevealed {
+		return
+	}
+
+	// Create a deep copy of the current players state
+	playersCopy := make(map[string]*Player)
+	for id, player := range r.Players {
+		playerCopy := *player // Create a copy of the player
+		playersCopy[id] = &playerCopy
+	}
+
+	voteSession := VoteSession{
+		Players:   playersCopy,
+		Timestamp: time.Now(),
+		Link:      r.Link,
+		Result:    r.Result,
+		Estimate:  r.Estimate,
 	}
 
-	// Transfer creator role
-	initiator.IsCreator = false
-	newCreator.IsCreator = true
+	// Tie the round to the story it estimated
+	if story := r.currentStory(); story != nil {
+		voteSession.StoryID = story.ID
+		voteSession.StoryTitle = story.Title
+	}
+
+	r.VoteHistory = append(r.VoteHistory, voteSession)
+}
+
+// reveal shows all cards and computes the round result, announcing it with the
+// given event type. It must run on the room's goroutine.
+func (r *Room) reveal(eventType string) {
+	r.cancelAutoReveal()
+	r.cancelTimer()
 
-	// Broadcast creator transferred event
+	r.Status = StatusRevealed
+	r.Result = computeRoundResult(r.Players, r.Deck)
+	r.afterCommit(metrics.Reveals.Inc)
+
+	// Broadcast reveal event
 	r.broadcastEvent(Event{
-		Type: EventTypeCreatorTransferred,
-		Payload: map[string]interface{}{
-			"previousCreator": initiator.Name,
-			"newCreator":      newCreator.Name,
-		},
+		Type:    eventType,
+		Payload: r.view(),
 	})
+}
 
-	return true
+// resetRound clears the votes and starts a new round. It must run on the room's
+// goroutine.
+func (r *Room) resetRound() {
+	r.cancelAutoReveal()
+	r.cancelTimer()
+
+	r.Status = StatusVoting
+	r.VotingLocked = false
+	r.Result = nil
+	r.Estimate = ""
+
+	for _, player := range r.Players {
+		player.Card = Unknown
+	}
 }
 
-// Subscribe registers a new client to receive events
-func (r *Room) Subscribe() chan Event {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+// revokeSessions removes all session tokens of a player. It must run on the
+// room's goroutine.
+func (r *Room) revokeSessions(playerID string) {
+	for hash, owner := range r.Sessions {
+		if owner == playerID {
+			delete(r.Sessions, hash)
+		}
+	}
+}
 
-	eventChan := make(chan Event, 10)
-	r.Clients[eventChan] = true
+// logger returns the logger for records about the room
+func (r *Room) logger() *slog.Logger {
+	return slog.With("room", r.ID)
+}
 
-	return eventChan
+// hashToken returns the hex-encoded SHA-256 hash of a session token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-// Unsubscribe removes a client from receiving events
-func (r *Room) Unsubscribe(eventChan chan Event) {
-	r.Mutex.Lock()
-	defer r.Mutex.Unlock()
+// notifyChange records activity, bumps the version of the room and passes its
+// state to the change handler and the other instances, if any. Within a
+// transaction this is left to the commit of the command. It must run on the
+// room's goroutine.
+func (r *Room) notifyChange() {
+	r.dirty = true
+	r.LastActivity = time.Now()
+
+	if r.tx != nil {
+		r.tx.changed = true
+		return
+	}
+
+	baseVersion, baseAuthor := r.Version, r.Author
+	r.Version++
+	r.Author = r.instance
+
+	if r.onChange == nil && r.publisher == nil {
+		return
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		r.logger().Error("Failed to serialize room", "error", err)
+		return
+	}
+
+	r.share(data, baseVersion, baseAuthor)
+}
 
-	if _, exists := r.Clients[eventChan]; exists {
-		delete(r.Clients, eventChan)
-		close(eventChan)
+// share passes the serialized state of the room, changed from the given base
+// version, to the change handler and the other instances, if any. It must run
+// on the room's goroutine.
+func (r *Room) share(data []byte, baseVersion uint64, baseAuthor string) {
+	if r.onChange != nil {
+		r.onChange(r.ID, data)
+	}
+	if r.publisher != nil {
+		r.publish(replicationMessage{
+			State:       data,
+			BaseVersion: baseVersion,
+			BaseAuthor:  baseAuthor,
+		})
 	}
 }
 
-// broadcastEvent sends an event to all subscribed clients
+// broadcastEvent sends an event to the clients of this instance and publishes
+// it to the other ones. It must run on the room's goroutine.
 func (r *Room) broadcastEvent(event Event) {
-	for client := range r.Clients {
+	r.deliver(event)
+	r.publishEvent(event, false)
+}
+
+// deliver gives an event the next sequence number of the room, keeps it for
+// clients catching up later and sends it to all subscribed clients, once the
+// current command is committed. It must run on the room's goroutine.
+func (r *Room) deliver(event Event) {
+	r.afterCommit(func() {
+		r.record(&event)
+		r.send(event)
+	})
+}
+
+// record gives an event the next sequence number of the room and keeps it for
+// clients catching up later. It must run on the room's goroutine.
+func (r *Room) record(event *Event) {
+	if r.events == nil {
+		r.events = &eventLog{}
+	}
+
+	r.Seq++
+	event.Seq = r.Seq
+	r.dirty = true
+	r.events.add(*event)
+}
+
+// send delivers an event to all subscribed clients once the current command
+// is committed, projecting viewer-dependent payloads for each of them. Clients
+// that keep missing events because they do not consume them fast enough are
+// disconnected, closing their channel, so that they resync instead of silently
+// diverging.
+func (r *Room) send(event Event) {
+	r.afterCommit(func() {
+		r.sendNow(event)
+	})
+}
+
+// sendNow delivers an event to all subscribed clients. It must run on the
+// room's goroutine.
+func (r *Room) sendNow(event Event) {
+	metrics.EventsBroadcast.Inc()
+	projected, isViewerPayload := event.Payload.(viewerPayload)
+
+	for client, subscriber := range r.Clients {
+		clientEvent := event
+		if isViewerPayload {
+			clientEvent.Payload = projected.forViewer(subscriber.ViewerID)
+		}
+
 		select {
-		case client <- event:
-			// Event sent successfully
+		case client <- clientEvent:
+			// The client keeps up again, only consecutive misses count
+			subscriber.Dropped = 0
 		default:
-			// Client might be blocked, but we don't want to block here
-			// We could implement a cleanup mechanism for stale clients
+			// Never block the room on a slow client
+			subscriber.Dropped++
+			metrics.EventsDropped.Inc()
+
+			if subscriber.Dropped > maxDroppedEvents {
+				r.logger().Warn("Evicting slow subscriber", "player", subscriber.ViewerID, "dropped", subscriber.Dropped)
+				r.unsubscribe(client)
+				metrics.SubscribersEvicted.Inc()
+			}
 		}
 	}
 }
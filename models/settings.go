@@ -0,0 +1,153 @@
+package models
+
+import "time"
+
+// Settings limits
+const maxAutoRevealDelay = 60
+
+// RoomSettings holds the options of a room
+type RoomSettings struct {
+	// AutoReveal reveals the cards once every voter has voted
+	AutoReveal bool `json:"autoReveal"`
+	// AutoRevealDelay is the grace period in seconds during which votes can
+	// still change before the automatic reveal
+	AutoRevealDelay int `json:"autoRevealDelay"`
+}
+
+// SettingsUpdate holds the settings to change; nil fields are left untouched
+type SettingsUpdate struct {
+	AutoReveal      *bool `json:"autoReveal"`
+	AutoRevealDelay *int  `json:"autoRevealDelay"`
+}
+
+// UpdateSettings changes the room settings
+func (r *Room) UpdateSettings(initiatorID string, update SettingsUpdate) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		settings := r.Settings
+		if update.AutoReveal != nil {
+			settings.AutoReveal = *update.AutoReveal
+		}
+		if update.AutoRevealDelay != nil {
+			settings.AutoRevealDelay = *update.AutoRevealDelay
+		}
+
+		if settings.AutoRevealDelay < 0 || settings.AutoRevealDelay > maxAutoRevealDelay {
+			return ErrInvalidSettings
+		}
+
+		r.Settings = settings
+
+		r.broadcastEvent(Event{
+			Type:    EventTypeSettingsUpdated,
+			Payload: settings,
+		})
+
+		// Turning auto-reveal off cancels a pending reveal, turning it on may
+		// trigger one right away
+		if !settings.AutoReveal {
+			r.cancelAutoReveal()
+		}
+		r.checkAutoReveal()
+
+		r.notifyChange()
+		r.logger().Info("Settings updated", "player", initiatorID, "autoReveal", settings.AutoReveal, "delay", settings.AutoRevealDelay)
+
+		return nil
+	})
+}
+
+// checkAutoReveal reveals the cards, or schedules the reveal after the grace
+// delay, when auto-reveal is on and every voter has voted. It must run on the
+// room's goroutine.
+func (r *Room) checkAutoReveal() {
+	if !r.Settings.AutoReveal || r.Status != StatusVoting || r.autoRevealTimer != nil || !r.allVoted() {
+		return
+	}
+
+	if r.Settings.AutoRevealDelay == 0 {
+		r.reveal(EventTypeCardsAutoRevealed)
+		return
+	}
+
+	delay := time.Duration(r.Settings.AutoRevealDelay) * time.Second
+
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		r.do(func() {
+			// Ignore timers that were cancelled after firing
+			if r.autoRevealTimer != timer {
+				return
+			}
+			r.autoRevealTimer = nil
+
+			// Votes may have been withdrawn by players joining during the delay
+			if r.Status != StatusVoting || !r.allVoted() {
+				r.broadcastEvent(Event{
+					Type:    EventTypeAutoRevealCancelled,
+					Payload: nil,
+				})
+				return
+			}
+
+			r.reveal(EventTypeCardsAutoRevealed)
+			r.notifyChange()
+		})
+	})
+	r.autoRevealTimer = timer
+	r.onRollback(func() { timer.Stop() })
+
+	r.broadcastEvent(Event{
+		Type: EventTypeAutoRevealScheduled,
+		Payload: map[string]interface{}{
+			"revealAt": time.Now().Add(delay),
+		},
+	})
+}
+
+// cancelAutoReveal stops a pending automatic reveal and lets clients know it
+// will not happen. It must run on the room's goroutine.
+func (r *Room) cancelAutoReveal() {
+	if !r.stopAutoReveal() {
+		return
+	}
+
+	r.broadcastEvent(Event{
+		Type:    EventTypeAutoRevealCancelled,
+		Payload: nil,
+	})
+}
+
+// stopAutoReveal stops a pending automatic reveal without telling clients and
+// reports whether one was pending. It must run on the room's goroutine.
+func (r *Room) stopAutoReveal() bool {
+	if r.autoRevealTimer == nil {
+		return false
+	}
+
+	timer := r.autoRevealTimer
+	r.afterCommit(func() { timer.Stop() })
+	r.autoRevealTimer = nil
+
+	return true
+}
+
+// allVoted reports whether every voter has voted. It must run on the room's
+// goroutine.
+func (r *Room) allVoted() bool {
+	voters := 0
+	for _, player := range r.Players {
+		if !player.IsVoter() {
+			continue
+		}
+		if player.Card == Unknown {
+			return false
+		}
+		voters++
+	}
+
+	return voters > 0
+}
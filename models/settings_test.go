@@ -0,0 +1,69 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// waitForEvent returns the first event of the given type sent to a client
+func waitForEvent(t *testing.T, events chan Event, eventType string) Event {
+	t.Helper()
+
+	deadline := time.After(3 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == eventType {
+				return event
+			}
+		case <-deadline:
+			t.Fatalf("no %s event received", eventType)
+			return Event{}
+		}
+	}
+}
+
+// scheduleAutoReveal turns on auto-reveal with a delay and votes, scheduling
+// the reveal of the cards
+func scheduleAutoReveal(t *testing.T, room *Room, creatorID string) chan Event {
+	t.Helper()
+
+	events := room.Subscribe(creatorID)
+
+	delay := 1
+	update := SettingsUpdate{AutoReveal: boolPointer(true), AutoRevealDelay: &delay}
+	if err := room.UpdateSettings(creatorID, update); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.SubmitVote(creatorID, "5"); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, EventTypeAutoRevealScheduled)
+
+	return events
+}
+
+func TestAutoRevealCancelledByReset(t *testing.T) {
+	room, creatorID := newTestRoom(t)
+	events := scheduleAutoReveal(t, room, creatorID)
+
+	if err := room.ResetVoting(creatorID); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, EventTypeAutoRevealCancelled)
+}
+
+func TestAutoRevealCancelledByNewVoter(t *testing.T) {
+	room, creatorID := newTestRoom(t)
+	events := scheduleAutoReveal(t, room, creatorID)
+
+	// The newcomer has not voted when the delay ends
+	if _, err := room.AddPlayer("bob", RoleVoter); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, EventTypeAutoRevealCancelled)
+
+	if status := room.Snapshot().Status; status != StatusVoting {
+		t.Errorf("status = %s, want %s", status, StatusVoting)
+	}
+}
@@ -0,0 +1,154 @@
+package models
+
+import (
+	"math"
+	"sort"
+)
+
+// RoundResult summarizes the votes of a revealed round
+type RoundResult struct {
+	Votes        int          `json:"votes"`
+	Distribution map[Card]int `json:"distribution"`
+	Mode         []Card       `json:"mode"`
+	Mean         *float64     `json:"mean,omitempty"`
+	Median       *float64     `json:"median,omitempty"`
+	Min          *float64     `json:"min,omitempty"`
+	Max          *float64     `json:"max,omitempty"`
+	Spread       *float64     `json:"spread,omitempty"`
+	MinVoters    []string     `json:"minVoters"`
+	MaxVoters    []string     `json:"maxVoters"`
+	Unsure       int          `json:"unsure"`
+	Breaks       int          `json:"breaks"`
+	Consensus    bool         `json:"consensus"`
+	Suggested    Card         `json:"suggested,omitempty"`
+}
+
+// computeRoundResult calculates the statistics of the players' votes
+func computeRoundResult(players map[string]*Player, deck Deck) *RoundResult {
+	result := &RoundResult{
+		Distribution: make(map[Card]int),
+		Mode:         make([]Card, 0),
+		MinVoters:    make([]string, 0),
+		MaxVoters:    make([]string, 0),
+	}
+
+	var values []float64
+	var minVoters, maxVoters []string
+	minValue, maxValue := math.Inf(1), math.Inf(-1)
+
+	for _, player := range players {
+		if !player.IsVoter() || player.Card == Unknown {
+			continue
+		}
+
+		result.Votes++
+		result.Distribution[player.Card]++
+
+		switch player.Card {
+		case Question:
+			result.Unsure++
+			continue
+		case Coffee:
+			result.Breaks++
+			continue
+		}
+
+		value, isNumeric := deck.NumericValue(player.Card)
+		if !isNumeric {
+			continue
+		}
+		values = append(values, value)
+
+		switch {
+		case value < minValue:
+			minValue, minVoters = value, []string{player.Name}
+		case value == minValue:
+			minVoters = append(minVoters, player.Name)
+		}
+		switch {
+		case value > maxValue:
+			maxValue, maxVoters = value, []string{player.Name}
+		case value == maxValue:
+			maxVoters = append(maxVoters, player.Name)
+		}
+	}
+
+	// Most frequent cards, in deck order
+	best := 0
+	for _, card := range deck.Cards {
+		count := result.Distribution[card.Value]
+		switch {
+		case count == 0:
+		case count > best:
+			best, result.Mode = count, []Card{card.Value}
+		case count == best:
+			result.Mode = append(result.Mode, card.Value)
+		}
+	}
+
+	// Consensus when every estimate is the same card
+	var estimate Card
+	result.Consensus = result.Votes > result.Breaks
+	for card := range result.Distribution {
+		if card == Coffee {
+			continue
+		}
+		if card == Question || (estimate != "" && card != estimate) {
+			result.Consensus = false
+			break
+		}
+		estimate = card
+	}
+
+	if len(values) > 0 {
+		sort.Float64s(values)
+		sort.Strings(minVoters)
+		sort.Strings(maxVoters)
+
+		sum := 0.0
+		for _, value := range values {
+			sum += value
+		}
+		mean := sum / float64(len(values))
+
+		middle := len(values) / 2
+		median := values[middle]
+		if len(values)%2 == 0 {
+			median = (values[middle-1] + values[middle]) / 2
+		}
+		spread := maxValue - minValue
+
+		result.Mean = &mean
+		result.Median = &median
+		result.Min = &minValue
+		result.Max = &maxValue
+		result.Spread = &spread
+		result.MinVoters = minVoters
+		result.MaxVoters = maxVoters
+		result.Suggested = nearestCard(deck, mean)
+	} else if len(result.Mode) == 1 && result.Mode[0] != Question && result.Mode[0] != Coffee {
+		result.Suggested = result.Mode[0]
+	}
+
+	return result
+}
+
+// nearestCard returns the numeric deck card closest to a value, preferring
+// the higher card on ties
+func nearestCard(deck Deck, value float64) Card {
+	var nearest Card
+	bestDistance := math.Inf(1)
+
+	for _, card := range deck.Cards {
+		if card.Numeric == nil {
+			continue
+		}
+
+		distance := math.Abs(*card.Numeric - value)
+		if distance < bestDistance || (distance == bestDistance && *card.Numeric > value) {
+			nearest, bestDistance = card.Value, distance
+		}
+	}
+
+	return nearest
+}
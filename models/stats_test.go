@@ -0,0 +1,181 @@
+package models
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// vote is a card played by a player in a stats test
+type vote struct {
+	name string
+	card Card
+	role string
+}
+
+// votePlayers returns the players casting the given votes, voters by default
+func votePlayers(votes []vote) map[string]*Player {
+	players := make(map[string]*Player, len(votes))
+	for i, v := range votes {
+		role := v.role
+		if role == "" {
+			role = RoleVoter
+		}
+		id := strconv.Itoa(i)
+		players[id] = &Player{ID: id, Name: v.name, Card: v.card, Role: role}
+	}
+
+	return players
+}
+
+// stat returns a pointer to an expected statistic
+func stat(value float64) *float64 {
+	return &value
+}
+
+// formatOptional formats an optional statistic for error messages
+func formatOptional(value *float64) string {
+	if value == nil {
+		return "none"
+	}
+
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
+
+func TestComputeRoundResult(t *testing.T) {
+	tshirt, _ := PresetDeck(DeckTShirt)
+
+	tests := []struct {
+		name      string
+		deck      Deck
+		votes     []vote
+		mean      *float64
+		median    *float64
+		minVoters []string
+		maxVoters []string
+		unsure    int
+		breaks    int
+		consensus bool
+		suggested Card
+	}{
+		{
+			name:      "even count",
+			votes:     []vote{{"alice", "3", ""}, {"bob", "5", ""}, {"carol", "8", ""}, {"dave", "13", ""}},
+			mean:      stat(7.25),
+			median:    stat(6.5),
+			minVoters: []string{"alice"},
+			maxVoters: []string{"dave"},
+			suggested: "8",
+		},
+		{
+			name:      "ties on min and max",
+			votes:     []vote{{"dave", "8", ""}, {"alice", "2", ""}, {"carol", "8", ""}, {"bob", "2", ""}},
+			mean:      stat(5),
+			median:    stat(5),
+			minVoters: []string{"alice", "bob"},
+			maxVoters: []string{"carol", "dave"},
+			suggested: "5",
+		},
+		{
+			name:      "nearest card tie prefers the higher card",
+			votes:     []vote{{"alice", "2", ""}, {"bob", "3", ""}},
+			mean:      stat(2.5),
+			median:    stat(2.5),
+			minVoters: []string{"alice"},
+			maxVoters: []string{"bob"},
+			suggested: "3",
+		},
+		{
+			name:      "consensus ignores coffee",
+			votes:     []vote{{"alice", "5", ""}, {"bob", "5", ""}, {"carol", Coffee, ""}},
+			mean:      stat(5),
+			median:    stat(5),
+			minVoters: []string{"alice", "bob"},
+			maxVoters: []string{"alice", "bob"},
+			breaks:    1,
+			consensus: true,
+			suggested: "5",
+		},
+		{
+			name:      "unsure vote breaks consensus",
+			votes:     []vote{{"alice", "5", ""}, {"bob", Question, ""}},
+			mean:      stat(5),
+			median:    stat(5),
+			minVoters: []string{"alice"},
+			maxVoters: []string{"alice"},
+			unsure:    1,
+			suggested: "5",
+		},
+		{
+			name:      "observers and missing votes are ignored",
+			votes:     []vote{{"alice", "5", ""}, {"bob", Unknown, ""}, {"carol", "100", RoleObserver}},
+			mean:      stat(5),
+			median:    stat(5),
+			minVoters: []string{"alice"},
+			maxVoters: []string{"alice"},
+			consensus: true,
+			suggested: "5",
+		},
+		{
+			name:      "only breaks",
+			votes:     []vote{{"alice", Coffee, ""}, {"bob", Coffee, ""}},
+			minVoters: []string{},
+			maxVoters: []string{},
+			breaks:    2,
+		},
+		{
+			name:      "only unsure votes",
+			votes:     []vote{{"alice", Question, ""}},
+			minVoters: []string{},
+			maxVoters: []string{},
+			unsure:    1,
+		},
+		{
+			name:      "no numeric votes with consensus",
+			deck:      tshirt,
+			votes:     []vote{{"alice", "M", ""}, {"bob", "M", ""}},
+			minVoters: []string{},
+			maxVoters: []string{},
+			consensus: true,
+			suggested: "M",
+		},
+		{
+			name:      "no numeric votes without a single mode",
+			deck:      tshirt,
+			votes:     []vote{{"alice", "M", ""}, {"bob", "L", ""}},
+			minVoters: []string{},
+			maxVoters: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		deck := test.deck
+		if len(deck.Cards) == 0 {
+			deck = DefaultDeck()
+		}
+
+		result := computeRoundResult(votePlayers(test.votes), deck)
+
+		if !reflect.DeepEqual(result.Mean, test.mean) {
+			t.Errorf("%s: mean = %s, want %s", test.name, formatOptional(result.Mean), formatOptional(test.mean))
+		}
+		if !reflect.DeepEqual(result.Median, test.median) {
+			t.Errorf("%s: median = %s, want %s", test.name, formatOptional(result.Median), formatOptional(test.median))
+		}
+		if !reflect.DeepEqual(result.MinVoters, test.minVoters) {
+			t.Errorf("%s: min voters = %v, want %v", test.name, result.MinVoters, test.minVoters)
+		}
+		if !reflect.DeepEqual(result.MaxVoters, test.maxVoters) {
+			t.Errorf("%s: max voters = %v, want %v", test.name, result.MaxVoters, test.maxVoters)
+		}
+		if result.Unsure != test.unsure || result.Breaks != test.breaks {
+			t.Errorf("%s: unsure = %d, breaks = %d, want %d and %d", test.name, result.Unsure, result.Breaks, test.unsure, test.breaks)
+		}
+		if result.Consensus != test.consensus {
+			t.Errorf("%s: consensus = %v, want %v", test.name, result.Consensus, test.consensus)
+		}
+		if result.Suggested != test.suggested {
+			t.Errorf("%s: suggested = %q, want %q", test.name, result.Suggested, test.suggested)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Possible story statuses
+const (
+	StoryPending    = "pending"
+	StoryEstimating = "estimating"
+	StoryEstimated  = "estimated"
+	StorySkipped    = "skipped"
+)
+
+// Story limits
+const (
+	maxStories       = 200
+	maxStoryTitleLen = 200
+	maxStoryTextLen  = 2000
+	maxStoryLinkLen  = 2000
+)
+
+// Story is an item of the room's backlog to be estimated
+type Story struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Link        string    `json:"link"`
+	Status      string    `json:"status"`
+	Estimate    Card      `json:"estimate,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// StoryUpdate holds the story fields to change; nil fields are left untouched
+type StoryUpdate struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	Link        *string `json:"link"`
+	Status      *string `json:"status"`
+}
+
+// AddStory appends a story to the end of the backlog
+func (r *Room) AddStory(initiatorID, title, description, link string) (*Story, error) {
+	return callErr(r, func() (*Story, error) {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return nil, err
+		}
+
+		if len(r.Stories) >= maxStories || !validStory(title, description, link) {
+			return nil, ErrInvalidStory
+		}
+
+		story := &Story{
+			ID:          uuid.New().String(),
+			Title:       title,
+			Description: description,
+			Link:        link,
+			Status:      StoryPending,
+			CreatedAt:   time.Now(),
+		}
+		r.Stories = append(r.Stories, story)
+
+		r.broadcastStories()
+		r.notifyChange()
+		r.logger().Info("Story added", "player", initiatorID, "story", story.ID)
+
+		storyCopy := *story
+		return &storyCopy, nil
+	})
+}
+
+// UpdateStory edits a story of the backlog. Only pending and skipped stories
+// can have their status changed, and only between those two values.
+func (r *Room) UpdateStory(initiatorID, storyID string, update StoryUpdate) (*Story, error) {
+	return callErr(r, func() (*Story, error) {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return nil, err
+		}
+
+		story := r.findStory(storyID)
+		if story == nil {
+			return nil, ErrStoryNotFound
+		}
+
+		title, description, link := story.Title, story.Description, story.Link
+		if update.Title != nil {
+			title = *update.Title
+		}
+		if update.Description != nil {
+			description = *update.Description
+		}
+		if update.Link != nil {
+			link = *update.Link
+		}
+		if !validStory(title, description, link) {
+			return nil, ErrInvalidStory
+		}
+
+		status := story.Status
+		if update.Status != nil && *update.Status != story.Status {
+			requeue := *update.Status == StoryPending && story.Status == StorySkipped
+			skip := *update.Status == StorySkipped && story.Status == StoryPending
+			if !requeue && !skip {
+				return nil, ErrInvalidStory
+			}
+			status = *update.Status
+		}
+
+		story.Title, story.Description, story.Link, story.Status = title, description, link, status
+
+		// Keep the room link in sync with the story being estimated
+		if story.ID == r.CurrentStoryID && r.Link != story.Link {
+			r.Link = story.Link
+			r.broadcastEvent(Event{
+				Type:    EventTypeLinkUpdated,
+				Payload: map[string]string{"link": r.Link},
+			})
+		}
+
+		r.broadcastStories()
+		r.notifyChange()
+		r.logger().Info("Story updated", "player", initiatorID, "story", storyID, "status", status)
+
+		storyCopy := *story
+		return &storyCopy, nil
+	})
+}
+
+// DeleteStory removes a story from the backlog
+func (r *Room) DeleteStory(initiatorID, storyID string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		index := -1
+		for i, story := range r.Stories {
+			if story.ID == storyID {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			return ErrStoryNotFound
+		}
+
+		r.Stories = append(r.Stories[:index], r.Stories[index+1:]...)
+		if r.CurrentStoryID == storyID {
+			r.CurrentStoryID = ""
+		}
+
+		r.broadcastStories()
+		r.notifyChange()
+		r.logger().Info("Story deleted", "player", initiatorID, "story", storyID)
+
+		return nil
+	})
+}
+
+// ReorderStories sets the order of the backlog. The given IDs must list every
+// story exactly once.
+func (r *Room) ReorderStories(initiatorID string, storyIDs []string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		if len(storyIDs) != len(r.Stories) {
+			return ErrInvalidOrder
+		}
+
+		byID := make(map[string]*Story, len(r.Stories))
+		for _, story := range r.Stories {
+			byID[story.ID] = story
+		}
+
+		ordered := make([]*Story, 0, len(storyIDs))
+		for _, id := range storyIDs {
+			story, exists := byID[id]
+			if !exists {
+				return ErrInvalidOrder
+			}
+			delete(byID, id)
+			ordered = append(ordered, story)
+		}
+
+		r.Stories = ordered
+
+		r.broadcastStories()
+		r.notifyChange()
+		r.logger().Info("Stories reordered", "player", initiatorID)
+
+		return nil
+	})
+}
+
+// NextStory finishes the story being estimated and starts estimating the
+// first pending story of the backlog, resetting the round. The finished story
+// is marked estimated if one of its rounds was revealed, and skipped
+// otherwise. It returns nil once the backlog has no pending stories left.
+func (r *Room) NextStory(initiatorID string) (*Story, error) {
+	return callErr(r, func() (*Story, error) {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return nil, err
+		}
+
+		var next *Story
+		for _, story := range r.Stories {
+			if story.Status == StoryPending {
+				next = story
+				break
+			}
+		}
+
+		if next == nil && r.currentStory() == nil {
+			return nil, ErrNoPendingStory
+		}
+
+		r.archiveRound()
+		r.finishCurrentStory()
+		r.resetRound()
+
+		r.Link = ""
+		if next != nil {
+			next.Status = StoryEstimating
+			r.CurrentStoryID = next.ID
+			r.Link = next.Link
+		}
+
+		r.broadcastEvent(Event{
+			Type:    EventTypeStoryStarted,
+			Payload: r.view(),
+		})
+
+		r.notifyChange()
+		r.logger().Info("Story started", "player", initiatorID, "story", r.CurrentStoryID)
+
+		if next == nil {
+			return nil, nil
+		}
+
+		storyCopy := *next
+		return &storyCopy, nil
+	})
+}
+
+// currentStory returns the story being estimated, if any. It must run on the
+// room's goroutine.
+func (r *Room) currentStory() *Story {
+	if r.CurrentStoryID == "" {
+		return nil
+	}
+
+	return r.findStory(r.CurrentStoryID)
+}
+
+// findStory returns a story by ID. It must run on the room's goroutine.
+func (r *Room) findStory(storyID string) *Story {
+	for _, story := range r.Stories {
+		if story.ID == storyID {
+			return story
+		}
+	}
+
+	return nil
+}
+
+// finishCurrentStory marks the story being estimated as estimated, using the
+// accepted estimate or else the suggested card of its last revealed round, or
+// skipped if it has none. It must run on the room's goroutine.
+func (r *Room) finishCurrentStory() {
+	story := r.currentStory()
+	r.CurrentStoryID = ""
+	if story == nil {
+		return
+	}
+
+	story.Status = StorySkipped
+	for i := len(r.VoteHistory) - 1; i >= 0; i-- {
+		session := r.VoteHistory[i]
+		if session.StoryID != story.ID {
+			continue
+		}
+
+		estimate := session.Estimate
+		if estimate == "" && session.Result != nil {
+			estimate = session.Result.Suggested
+		}
+		if estimate != "" {
+			story.Status = StoryEstimated
+			story.Estimate = estimate
+			return
+		}
+	}
+}
+
+// broadcastStories sends the current backlog to all clients. It must run on the
+// room's goroutine.
+func (r *Room) broadcastStories() {
+	r.broadcastEvent(Event{
+		Type:    EventTypeStoriesUpdated,
+		Payload: copyStories(r.Stories),
+	})
+}
+
+// copyStories returns a deep copy of a backlog
+func copyStories(stories []*Story) []*Story {
+	copies := make([]*Story, len(stories))
+	for i, story := range stories {
+		storyCopy := *story
+		copies[i] = &storyCopy
+	}
+
+	return copies
+}
+
+// validStory checks the length limits of a story's fields
+func validStory(title, description, link string) bool {
+	return title != "" &&
+		len(title) <= maxStoryTitleLen &&
+		len(description) <= maxStoryTextLen &&
+		len(link) <= maxStoryLinkLen
+}
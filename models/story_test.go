@@ -0,0 +1,34 @@
+package models
+
+import "testing"
+
+func TestResetVotingLink(t *testing.T) {
+	room, creatorID := newTestRoom(t)
+
+	if err := room.UpdateLink(creatorID, "https://example.com/adhoc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ResetVoting(creatorID); err != nil {
+		t.Fatal(err)
+	}
+	if link := room.Snapshot().Link; link != "" {
+		t.Errorf("link without a story = %q, want it cleared", link)
+	}
+
+	const storyLink = "https://example.com/story"
+	if _, err := room.AddStory(creatorID, "Login page", "", storyLink); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := room.NextStory(creatorID); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.UpdateLink(creatorID, "https://example.com/adhoc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.ResetVoting(creatorID); err != nil {
+		t.Fatal(err)
+	}
+	if link := room.Snapshot().Link; link != storyLink {
+		t.Errorf("link during a story = %q, want %q", link, storyLink)
+	}
+}
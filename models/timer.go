@@ -0,0 +1,209 @@
+package models
+
+import "time"
+
+// Possible actions when a round timer expires
+const (
+	TimerActionReveal = "reveal"
+	TimerActionLock   = "lock"
+)
+
+// Timer limits, in seconds
+const (
+	minTimerDuration = 5
+	maxTimerDuration = 3600
+)
+
+// RoundTimer is a countdown for the current round whose deadline is owned by
+// the server
+type RoundTimer struct {
+	Duration  int       `json:"duration"`
+	StartedAt time.Time `json:"startedAt"`
+	EndsAt    time.Time `json:"endsAt"`
+	Action    string    `json:"action"`
+	Tick      bool      `json:"tick"`
+}
+
+// timerRun holds the scheduled callbacks of a running round timer
+type timerRun struct {
+	expiry *time.Timer
+	stop   chan struct{}
+}
+
+// StartTimer starts a countdown of the given number of seconds for the current
+// round, replacing any running one. When it expires the cards are revealed or
+// voting is locked, depending on the action. With tick set, the remaining time
+// is broadcast every second.
+func (r *Room) StartTimer(initiatorID string, duration int, action string, tick bool) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		if r.Status != StatusVoting {
+			return ErrNotVoting
+		}
+
+		if duration < minTimerDuration || duration > maxTimerDuration {
+			return ErrInvalidTimer
+		}
+		if action != TimerActionReveal && action != TimerActionLock {
+			return ErrInvalidTimer
+		}
+
+		r.stopTimer()
+
+		now := time.Now()
+		r.Timer = &RoundTimer{
+			Duration:  duration,
+			StartedAt: now,
+			EndsAt:    now.Add(time.Duration(duration) * time.Second),
+			Action:    action,
+			Tick:      tick,
+		}
+		r.VotingLocked = false
+		r.armTimer()
+
+		timerCopy := *r.Timer
+		r.broadcastEvent(Event{
+			Type:    EventTypeTimerStarted,
+			Payload: &timerCopy,
+		})
+
+		r.notifyChange()
+		r.logger().Info("Timer started", "player", initiatorID, "duration", duration, "action", action)
+
+		return nil
+	})
+}
+
+// CancelTimer stops the running round timer
+func (r *Room) CancelTimer(initiatorID string) error {
+	return call(r, ErrRoomNotFound, func() error {
+		if err := r.requireFacilitator(initiatorID); err != nil {
+			return err
+		}
+
+		if r.Timer == nil {
+			return ErrNoTimer
+		}
+
+		r.cancelTimer()
+
+		r.notifyChange()
+		r.logger().Info("Timer cancelled", "player", initiatorID)
+
+		return nil
+	})
+}
+
+// armTimer schedules the expiry, and ticks if enabled, of the room's round
+// timer. It must run on the room's goroutine.
+func (r *Room) armTimer() {
+	run := &timerRun{stop: make(chan struct{})}
+	r.timerRun = run
+	r.onRollback(run.cancel)
+
+	run.expiry = time.AfterFunc(time.Until(r.Timer.EndsAt), func() {
+		r.do(func() {
+			// Ignore timers that were replaced or cancelled after firing
+			if r.timerRun != run {
+				return
+			}
+
+			r.expireTimer()
+			r.notifyChange()
+		})
+	})
+
+	if !r.Timer.Tick {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.do(func() {
+					if r.timerRun != run || r.Timer == nil {
+						return
+					}
+
+					remaining := time.Until(r.Timer.EndsAt).Round(time.Second)
+					r.broadcastTransient(Event{
+						Type: EventTypeTimerTick,
+						Payload: map[string]interface{}{
+							"remaining": int(remaining / time.Second),
+							"endsAt":    r.Timer.EndsAt,
+						},
+					})
+				})
+			case <-run.stop:
+				return
+			case <-r.closed:
+				return
+			}
+		}
+	}()
+}
+
+// expireTimer applies the action of the round timer once its deadline has
+// passed. It must run on the room's goroutine.
+func (r *Room) expireTimer() {
+	action := r.Timer.Action
+	r.stopTimer()
+	r.Timer = nil
+
+	r.broadcastEvent(Event{
+		Type:    EventTypeTimerExpired,
+		Payload: map[string]string{"action": action},
+	})
+	r.logger().Info("Timer expired", "action", action)
+
+	if r.Status != StatusVoting {
+		return
+	}
+
+	switch action {
+	case TimerActionReveal:
+		r.reveal(EventTypeCardsAutoRevealed)
+	case TimerActionLock:
+		r.VotingLocked = true
+	}
+}
+
+// cancelTimer stops the round timer, letting clients know if one was running.
+// It must run on the room's goroutine.
+func (r *Room) cancelTimer() {
+	r.stopTimer()
+
+	if r.Timer == nil {
+		return
+	}
+	r.Timer = nil
+
+	r.broadcastEvent(Event{
+		Type:    EventTypeTimerCancelled,
+		Payload: nil,
+	})
+}
+
+// stopTimer stops the scheduled callbacks of the round timer. It must run on
+// the room's goroutine.
+func (r *Room) stopTimer() {
+	if r.timerRun == nil {
+		return
+	}
+
+	r.afterCommit(r.timerRun.cancel)
+	r.timerRun = nil
+}
+
+// cancel stops the scheduled callbacks of a timer run
+func (run *timerRun) cancel() {
+	run.expiry.Stop()
+	close(run.stop)
+}
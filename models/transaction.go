@@ -0,0 +1,201 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// maxCommitAttempts bounds the number of times a command runs again after its
+// changes conflicted with the ones of other instances
+const maxCommitAttempts = 10
+
+// CommitFunc stores the serialized state of a room shared with other
+// instances, provided the stored state still has the version and author the
+// changes were made on. Otherwise it returns the stored state, or nil if the
+// room was deleted.
+type CommitFunc func(roomID string, baseVersion uint64, baseAuthor string, data []byte) (stored []byte, committed bool, err error)
+
+// transaction tracks a command run on a room with a commit handler, so that
+// it can run again on the newer state if its changes conflict with the ones
+// of another instance. What the command does beyond changing the room state
+// is either deferred until its changes are committed, or undone.
+type transaction struct {
+	changed bool
+
+	// effects are run once the changes are committed: events sent to clients
+	// and other instances, timers stopped, metrics
+	effects []func()
+	// rollbacks cancel the timers scheduled by the command
+	rollbacks []func()
+
+	// State of this instance only, restored on conflict
+	connections     map[string]int
+	removalTimers   map[string]*time.Timer
+	autoRevealTimer *time.Timer
+	timerRun        *timerRun
+}
+
+// SetCommitHandler registers a function storing the room state after each
+// command that changed it. Commands whose changes conflict with the ones of
+// another instance run again on the stored state.
+func (r *Room) SetCommitHandler(fn CommitFunc) {
+	r.do(func() {
+		r.commitHandler = fn
+	})
+}
+
+// transact runs a command and commits its changes through the commit handler,
+// if any. On conflict the command runs again on the stored state, which
+// clients are sent. It reports false if the room was deleted meanwhile or the
+// conflicts persisted. It must run on the room's goroutine.
+func (r *Room) transact(fn func()) bool {
+	if r.commitHandler == nil {
+		fn()
+		return true
+	}
+
+	defer func() {
+		r.tx = nil
+	}()
+
+	var stored *Room
+	for attempt := 0; attempt < maxCommitAttempts; attempt++ {
+		r.tx = r.newTransaction()
+		if stored != nil {
+			r.replaceState(stored, true)
+			r.reconnectLocalPlayers()
+		}
+
+		fn()
+
+		tx := r.tx
+		r.tx = nil
+
+		var committed bool
+		if stored, committed = r.commit(tx); committed {
+			return true
+		}
+
+		r.rollback(tx)
+		if stored == nil {
+			r.logger().Info("Room deleted by another instance")
+			r.Close()
+			return false
+		}
+	}
+
+	// Keep the changes of the other instances rather than the command's
+	r.replaceState(stored, true)
+	r.logger().Error("Failed to commit changes conflicting with other instances", "attempts", maxCommitAttempts)
+
+	return false
+}
+
+// newTransaction starts tracking a command. It must run on the room's
+// goroutine.
+func (r *Room) newTransaction() *transaction {
+	tx := &transaction{
+		autoRevealTimer: r.autoRevealTimer,
+		timerRun:        r.timerRun,
+	}
+
+	if r.connections != nil {
+		tx.connections = make(map[string]int, len(r.connections))
+		for playerID, count := range r.connections {
+			tx.connections[playerID] = count
+		}
+	}
+	if r.removalTimers != nil {
+		tx.removalTimers = make(map[string]*time.Timer, len(r.removalTimers))
+		for playerID, timer := range r.removalTimers {
+			tx.removalTimers[playerID] = timer
+		}
+	}
+
+	return tx
+}
+
+// commit stores the changes of a command and runs its effects. Changes
+// conflicting with the ones of another instance are not stored: the stored
+// state is returned instead, or nil if the room was deleted. Changes that
+// cannot be stored because of an error are kept locally. It must run on the
+// room's goroutine.
+func (r *Room) commit(tx *transaction) (*Room, bool) {
+	if !tx.changed {
+		tx.apply()
+		return nil, true
+	}
+
+	baseVersion, baseAuthor := r.Version, r.Author
+	r.Version++
+	r.Author = r.instance
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		r.logger().Error("Failed to serialize room", "error", err)
+		tx.apply()
+		return nil, true
+	}
+
+	stored, committed, err := r.commitHandler(r.ID, baseVersion, baseAuthor, data)
+	if err == nil && !committed {
+		if stored == nil {
+			return nil, false
+		}
+
+		current := &Room{}
+		if err = json.Unmarshal(stored, current); err == nil {
+			return current, false
+		}
+	}
+	if err != nil {
+		r.logger().Error("Failed to commit changes", "error", err)
+	}
+
+	tx.apply()
+	r.share(data, baseVersion, baseAuthor)
+
+	return nil, true
+}
+
+// rollback cancels the timers scheduled by a command whose changes were not
+// committed and restores the state of this instance. Its effects are dropped.
+// It must run on the room's goroutine.
+func (r *Room) rollback(tx *transaction) {
+	for _, cancel := range tx.rollbacks {
+		cancel()
+	}
+
+	r.connections = tx.connections
+	r.removalTimers = tx.removalTimers
+	r.autoRevealTimer = tx.autoRevealTimer
+	r.timerRun = tx.timerRun
+}
+
+// apply runs the effects of a committed command, in order
+func (tx *transaction) apply() {
+	for _, effect := range tx.effects {
+		effect()
+	}
+}
+
+// afterCommit runs fn once the changes of the current command are committed,
+// or right away outside of a transaction. It must run on the room's
+// goroutine.
+func (r *Room) afterCommit(fn func()) {
+	if r.tx == nil {
+		fn()
+		return
+	}
+
+	r.tx.effects = append(r.tx.effects, fn)
+}
+
+// onRollback registers a function cancelling a timer scheduled by the current
+// command, called if its changes are not committed. It must run on the room's
+// goroutine.
+func (r *Room) onRollback(cancel func()) {
+	if r.tx != nil {
+		r.tx.rollbacks = append(r.tx.rollbacks, cancel)
+	}
+}
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sharedState stores the state of a room the way the Redis store does,
+// committing changes only if they were made on the stored version
+type sharedState struct {
+	mutex     sync.Mutex
+	data      []byte
+	conflicts int
+}
+
+// commit is the commit handler of the rooms sharing the state
+func (s *sharedState) commit(roomID string, baseVersion uint64, baseAuthor string, data []byte) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.data == nil {
+		return nil, false, nil
+	}
+
+	var stored Room
+	if err := json.Unmarshal(s.data, &stored); err != nil {
+		return nil, false, err
+	}
+	if stored.Version != baseVersion || stored.Author != baseAuthor {
+		s.conflicts++
+		return s.data, false, nil
+	}
+
+	s.data = data
+	return nil, true, nil
+}
+
+// room decodes the stored state
+func (s *sharedState) room(t *testing.T) *Room {
+	t.Helper()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	room := &Room{}
+	if err := json.Unmarshal(s.data, room); err != nil {
+		t.Fatal(err)
+	}
+
+	return room
+}
+
+// shareRoom creates a room with alice and bob and a replica of it, both
+// committing to the same state. They publish nothing, so that each one only
+// learns about the changes of the other through conflicts.
+func shareRoom(t *testing.T) (*Room, *Room, *sharedState, string, string) {
+	t.Helper()
+
+	room := NewRoom("alice", DefaultDeck())
+	t.Cleanup(room.Close)
+
+	aliceID := ""
+	for id := range room.Snapshot().Players {
+		aliceID = id
+	}
+	bobID, err := room.AddPlayer("bob", RoleVoter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := room.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := &sharedState{data: data}
+
+	replica, err := RestoreReplica(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(replica.Close)
+
+	room.SetPublisher("a", nil)
+	room.SetCommitHandler(shared.commit)
+	replica.SetPublisher("b", nil)
+	replica.SetCommitHandler(shared.commit)
+
+	return room, replica, shared, aliceID, bobID
+}
+
+// nextEvent returns the next event sent to a client
+func nextEvent(t *testing.T, events chan Event) Event {
+	t.Helper()
+
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestConcurrentChangesAreKept(t *testing.T) {
+	room, replica, shared, aliceID, bobID := shareRoom(t)
+	events := replica.Subscribe(bobID)
+
+	if err := room.SubmitVote(aliceID, "5"); err != nil {
+		t.Fatal(err)
+	}
+	// The replica does not know about the vote of alice yet
+	if err := replica.SubmitVote(bobID, "8"); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := shared.room(t)
+	if stored.Players[aliceID].Card != "5" || stored.Players[bobID].Card != "8" {
+		t.Errorf("stored votes = %s and %s, want 5 and 8", stored.Players[aliceID].Card, stored.Players[bobID].Card)
+	}
+	if shared.conflicts != 1 {
+		t.Errorf("conflicts = %d, want 1", shared.conflicts)
+	}
+
+	players := replica.Snapshot().Players
+	if players[aliceID].Card != "5" || players[bobID].Card != "8" {
+		t.Errorf("replica votes = %s and %s, want 5 and 8", players[aliceID].Card, players[bobID].Card)
+	}
+
+	// The clients of the replica get the stored state, then the vote once
+	if event := nextEvent(t, events); event.Type != EventTypeRoomSynced {
+		t.Errorf("first event = %s, want %s", event.Type, EventTypeRoomSynced)
+	}
+	if event := nextEvent(t, events); event.Type != EventTypeVoteSubmitted {
+		t.Errorf("second event = %s, want %s", event.Type, EventTypeVoteSubmitted)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("unexpected event %s", event.Type)
+	default:
+	}
+}
+
+func TestRejectedCommandRunsOnStoredState(t *testing.T) {
+	room, replica, shared, aliceID, bobID := shareRoom(t)
+
+	if err := room.UpdateSettings(aliceID, SettingsUpdate{AutoReveal: boolPointer(true)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := room.SubmitVote(aliceID, "5"); err != nil {
+		t.Fatal(err)
+	}
+
+	// On the stored state, bob is the last voter and his vote reveals the cards
+	if err := replica.SubmitVote(bobID, "8"); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored := shared.room(t); stored.Status != StatusRevealed {
+		t.Errorf("stored status = %s, want %s", stored.Status, StatusRevealed)
+	}
+	if status := replica.Snapshot().Status; status != StatusRevealed {
+		t.Errorf("replica status = %s, want %s", status, StatusRevealed)
+	}
+}
+
+func TestCommandOnDeletedRoom(t *testing.T) {
+	_, replica, shared, _, bobID := shareRoom(t)
+
+	shared.mutex.Lock()
+	shared.data = nil
+	shared.mutex.Unlock()
+
+	if err := replica.SubmitVote(bobID, "8"); err != ErrRoomNotFound {
+		t.Errorf("error = %v, want %v", err, ErrRoomNotFound)
+	}
+	if !replica.Closed() {
+		t.Error("replica of a deleted room is still open")
+	}
+}
+
+// boolPointer returns a pointer to a bool, for settings updates
+func boolPointer(value bool) *bool {
+	return &value
+}
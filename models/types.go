@@ -2,6 +2,7 @@ package models
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,31 +11,87 @@ type Player struct {
 	ID        string    `json:"id"`
 	Name      string    `json:"name"`
 	Card      Card      `json:"card"`
+	Role      string    `json:"role"`
 	IsCreator bool      `json:"isCreator"`
 	JoinedAt  time.Time `json:"joinedAt"`
+	Presence  string    `json:"presence"`
+	LastSeen  time.Time `json:"lastSeen"`
 }
 
 // VoteSession represents a completed voting session
 type VoteSession struct {
-	Players   map[string]*Player `json:"players"`
-	Timestamp time.Time          `json:"timestamp"`
-	Link      string             `json:"link"`
+	Players    map[string]*Player `json:"players"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Link       string             `json:"link"`
+	Result     *RoundResult       `json:"result,omitempty"`
+	Estimate   Card               `json:"estimate,omitempty"`
+	StoryID    string             `json:"storyId,omitempty"`
+	StoryTitle string             `json:"storyTitle,omitempty"`
 }
 
-// Room represents a planning poker session
+// Room represents a planning poker session. Its state is owned by a dedicated
+// goroutine: fields are exported for serialization only and must be accessed
+// through the room's methods.
 type Room struct {
-	ID          string              `json:"id"`
-	Players     map[string]*Player  `json:"players"`
-	Status      string              `json:"status"`
-	CreatedAt   time.Time           `json:"createdAt"`
-	VoteHistory []VoteSession       `json:"voteHistory"`
-	Link        string              `json:"link"`
-	Mutex       sync.RWMutex        `json:"-"`
-	Clients     map[chan Event]bool `json:"-"`
+	ID             string                     `json:"id"`
+	Players        map[string]*Player         `json:"players"`
+	Status         string                     `json:"status"`
+	CreatedAt      time.Time                  `json:"createdAt"`
+	LastActivity   time.Time                  `json:"lastActivity"`
+	VoteHistory    []VoteSession              `json:"voteHistory"`
+	Link           string                     `json:"link"`
+	Deck           Deck                       `json:"deck"`
+	Settings       RoomSettings               `json:"settings"`
+	Result         *RoundResult               `json:"result,omitempty"`
+	Estimate       Card                       `json:"estimate,omitempty"`
+	Timer          *RoundTimer                `json:"timer,omitempty"`
+	VotingLocked   bool                       `json:"votingLocked"`
+	Stories        []*Story                   `json:"stories"`
+	CurrentStoryID string                     `json:"currentStoryId,omitempty"`
+	Sessions       map[string]string          `json:"sessions"`
+	Seq            uint64                     `json:"seq"`
+	Version        uint64                     `json:"version"`
+	Author         string                     `json:"author,omitempty"`
+	Clients        map[chan Event]*Subscriber `json:"-"`
+
+	onChange        ChangeFunc
+	autoRevealTimer *time.Timer
+	timerRun        *timerRun
+	connections     map[string]int
+	removalTimers   map[string]*time.Timer
+	events          *eventLog
+	expiryWarned    time.Time
+
+	// Rooms shared with other instances commit their changes and publish
+	// them, tagged with the instance that made them
+	instance      string
+	publisher     Publisher
+	commitHandler CommitFunc
+	tx            *transaction
+
+	// The room state is owned by a single goroutine running the commands
+	// sent by the exported methods
+	commands  chan func()
+	closed    chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	snapshot  atomic.Pointer[RoomView]
+	dirty     bool
 }
 
+// Subscriber is a client receiving the events of a room
+type Subscriber struct {
+	ViewerID string
+	// Dropped is the number of events missed in a row
+	Dropped int
+}
+
+// ChangeFunc receives the serialized state of a room after each mutation
+type ChangeFunc func(roomID string, data []byte)
+
 // Event represents an SSE event to be sent to clients
 type Event struct {
 	Type    string      `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"`
 	Payload interface{} `json:"payload"`
 }
@@ -0,0 +1,127 @@
+package models
+
+import "time"
+
+// PlayerView is a player as seen by a single viewer
+type PlayerView struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Card      Card      `json:"card"`
+	HasVoted  bool      `json:"hasVoted"`
+	Role      string    `json:"role"`
+	IsCreator bool      `json:"isCreator"`
+	JoinedAt  time.Time `json:"joinedAt"`
+	Presence  string    `json:"presence"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// RoomView is a room as seen by a single viewer. Until cards are revealed,
+// only the viewer's own card is visible and other votes show as Hidden.
+type RoomView struct {
+	ID             string                 `json:"id"`
+	Players        map[string]*PlayerView `json:"players"`
+	Status         string                 `json:"status"`
+	CreatedAt      time.Time              `json:"createdAt"`
+	LastActivity   time.Time              `json:"lastActivity"`
+	VoteHistory    []VoteSession          `json:"voteHistory"`
+	Link           string                 `json:"link"`
+	Deck           Deck                   `json:"deck"`
+	Settings       RoomSettings           `json:"settings"`
+	Result         *RoundResult           `json:"result,omitempty"`
+	Estimate       Card                   `json:"estimate,omitempty"`
+	Timer          *RoundTimer            `json:"timer,omitempty"`
+	VotingLocked   bool                   `json:"votingLocked"`
+	Stories        []*Story               `json:"stories"`
+	CurrentStoryID string                 `json:"currentStoryId,omitempty"`
+	Seq            uint64                 `json:"seq"`
+	Instance       string                 `json:"instance,omitempty"`
+}
+
+// viewerPayload is implemented by event payloads that depend on who receives them
+type viewerPayload interface {
+	forViewer(viewerID string) interface{}
+}
+
+// ViewFor returns the room as seen by the given player
+func (r *Room) ViewFor(viewerID string) *RoomView {
+	return r.snapshot.Load().For(viewerID)
+}
+
+// view returns an unmasked copy of the room state. It must run on the room's
+// goroutine; the result is safe to share with other goroutines.
+func (r *Room) view() *RoomView {
+	players := make(map[string]*PlayerView, len(r.Players))
+	for id, player := range r.Players {
+		players[id] = newPlayerView(player)
+	}
+
+	return &RoomView{
+		ID:             r.ID,
+		Players:        players,
+		Status:         r.Status,
+		CreatedAt:      r.CreatedAt,
+		LastActivity:   r.LastActivity,
+		VoteHistory:    append(make([]VoteSession, 0, len(r.VoteHistory)), r.VoteHistory...),
+		Link:           r.Link,
+		Deck:           r.Deck,
+		Settings:       r.Settings,
+		Result:         r.Result,
+		Estimate:       r.Estimate,
+		Seq:            r.Seq,
+		Instance:       r.instance,
+		Timer:          copyTimer(r.Timer),
+		VotingLocked:   r.VotingLocked,
+		Stories:        copyStories(r.Stories),
+		CurrentStoryID: r.CurrentStoryID,
+	}
+}
+
+// For returns a copy of the view with the votes the viewer may not see hidden
+func (v *RoomView) For(viewerID string) *RoomView {
+	masked := *v
+	if v.Status == StatusRevealed {
+		return &masked
+	}
+
+	masked.Players = make(map[string]*PlayerView, len(v.Players))
+	for id, player := range v.Players {
+		if id != viewerID && player.HasVoted {
+			hidden := *player
+			hidden.Card = Hidden
+			player = &hidden
+		}
+		masked.Players[id] = player
+	}
+
+	return &masked
+}
+
+// forViewer implements viewerPayload
+func (v *RoomView) forViewer(viewerID string) interface{} {
+	return v.For(viewerID)
+}
+
+// copyTimer returns a copy of an optional round timer
+func copyTimer(timer *RoundTimer) *RoundTimer {
+	if timer == nil {
+		return nil
+	}
+
+	timerCopy := *timer
+	return &timerCopy
+}
+
+// newPlayerView copies a player into a view
+func newPlayerView(player *Player) *PlayerView {
+	return &PlayerView{
+		ID:        player.ID,
+		Name:      player.Name,
+		Card:      player.Card,
+		HasVoted:  player.Card != Unknown,
+		Role:      player.Role,
+		IsCreator: player.IsCreator,
+		JoinedAt:  player.JoinedAt,
+		Presence:  player.Presence,
+		LastSeen:  player.LastSeen,
+	}
+}
@@ -0,0 +1,270 @@
+// Package redis is a minimal client for the Redis serialization protocol
+// (RESP2), supporting the few commands the server needs
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Network timeouts
+const (
+	dialTimeout = 5 * time.Second
+	ioTimeout   = 5 * time.Second
+)
+
+// ErrProtocol is returned when the server sends a malformed reply
+var ErrProtocol = errors.New("redis: malformed reply")
+
+// Error is an error reply sent by the server
+type Error string
+
+// Error implements the error interface
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// Client sends commands one at a time over a single connection, reconnecting
+// on the next command after a network failure
+type Client struct {
+	addr     string
+	password string
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to a server, authenticating with the password if not empty
+func Dial(addr, password string) (*Client, error) {
+	c := &Client{addr: addr, password: password}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Do sends a command and returns its reply: a string for simple strings, an
+// int64 for integers, a []byte or nil for bulk strings, and a []interface{}
+// or nil for arrays. Error replies are returned as Error, and kept as Error
+// items within arrays.
+func (c *Client) Do(args ...string) (interface{}, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	c.conn.SetDeadline(time.Now().Add(ioTimeout))
+	reply, err := roundTrip(c.conn, c.reader, args)
+
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	return reply, err
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// connect opens the connection. It must be called with the client mutex held
+// or before the client is shared.
+func (c *Client) connect() error {
+	conn, reader, err := dial(c.addr, c.password)
+	if err != nil {
+		return err
+	}
+
+	c.conn, c.reader = conn, reader
+	return nil
+}
+
+// Subscription is a connection receiving the messages published on the
+// channels matching a pattern
+type Subscription struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// PSubscribe opens a connection subscribed to the channels matching a pattern
+func PSubscribe(addr, password, pattern string) (*Subscription, error) {
+	conn, reader, err := dial(addr, password)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(ioTimeout))
+	if err := writeCommand(conn, []string{"PSUBSCRIBE", pattern}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if _, err := readReply(reader); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return &Subscription{conn: conn, reader: reader}, nil
+}
+
+// Receive waits for the next message and returns its channel and payload
+func (s *Subscription) Receive() (string, []byte, error) {
+	for {
+		reply, err := readReply(s.reader)
+		if err != nil {
+			return "", nil, err
+		}
+
+		// Messages are ["pmessage", pattern, channel, payload]
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 4 {
+			continue
+		}
+		kind, _ := parts[0].([]byte)
+		channel, _ := parts[2].([]byte)
+		payload, _ := parts[3].([]byte)
+		if string(kind) != "pmessage" {
+			continue
+		}
+
+		return string(channel), payload, nil
+	}
+}
+
+// Close closes the subscription connection, making Receive return an error
+func (s *Subscription) Close() error {
+	return s.conn.Close()
+}
+
+// dial opens and authenticates a connection
+func dial(addr, password string) (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("redis: connect to %s: %w", addr, err)
+	}
+	reader := bufio.NewReader(conn)
+
+	if password != "" {
+		conn.SetDeadline(time.Now().Add(ioTimeout))
+		if _, err := roundTrip(conn, reader, []string{"AUTH", password}); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	return conn, reader, nil
+}
+
+// roundTrip sends a command and reads its reply
+func roundTrip(conn net.Conn, reader *bufio.Reader, args []string) (interface{}, error) {
+	if err := writeCommand(conn, args); err != nil {
+		return nil, err
+	}
+
+	return readReply(reader)
+}
+
+// writeCommand sends a command as an array of bulk strings
+func writeCommand(conn net.Conn, args []string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, "\r\n"...)
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+
+	_, err := conn.Write(buf)
+	return err
+}
+
+// readReply reads a single reply
+func readReply(reader *bufio.Reader) (interface{}, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, ErrProtocol
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return nil, Error(value)
+	case ':':
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, ErrProtocol
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < -1 {
+			return nil, ErrProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < -1 {
+			return nil, ErrProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readReply(reader)
+			var replyErr Error
+			if errors.As(err, &replyErr) {
+				item = replyErr
+			} else if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	default:
+		return nil, ErrProtocol
+	}
+}
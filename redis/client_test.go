@@ -0,0 +1,275 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// standIn is a local server speaking RESP, answering each command with the
+// raw reply returned by its handler. A handler returning an empty reply
+// drops the connection.
+type standIn struct {
+	listener net.Listener
+	handler  func(args []string) string
+
+	mutex       sync.Mutex
+	conns       []net.Conn
+	connections int
+}
+
+// newStandIn starts a stand-in server, stopped at the end of the test
+func newStandIn(t *testing.T, handler func(args []string) string) *standIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &standIn{listener: listener, handler: handler}
+	go s.serve()
+	t.Cleanup(s.close)
+
+	return s
+}
+
+// addr returns the address the stand-in listens on
+func (s *standIn) addr() string {
+	return s.listener.Addr().String()
+}
+
+// accepted returns the number of connections accepted so far
+func (s *standIn) accepted() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.connections
+}
+
+// serve accepts connections until the stand-in is closed
+func (s *standIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.connections++
+		s.mutex.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+// handle answers the commands of a connection
+func (s *standIn) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		reply, err := readReply(reader)
+		if err != nil {
+			return
+		}
+
+		var args []string
+		items, _ := reply.([]interface{})
+		for _, item := range items {
+			arg, _ := item.([]byte)
+			args = append(args, string(arg))
+		}
+
+		answer := s.handler(args)
+		if answer == "" {
+			return
+		}
+		if _, err := conn.Write([]byte(answer)); err != nil {
+			return
+		}
+	}
+}
+
+// close stops the stand-in and its connections
+func (s *standIn) close() {
+	s.listener.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// dialStandIn connects a client to the stand-in, closing it at the end of
+// the test
+func dialStandIn(t *testing.T, s *standIn) *Client {
+	t.Helper()
+
+	client, err := Dial(s.addr(), "")
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func TestDoReplies(t *testing.T) {
+	replies := map[string]string{
+		"status":  "+OK\r\n",
+		"integer": ":-42\r\n",
+		"bulk":    "$12\r\nhello\r\nworld\r\n",
+		"empty":   "$0\r\n\r\n",
+		"nil":     "$-1\r\n",
+		"array":   "*3\r\n$1\r\na\r\n:1\r\n$-1\r\n",
+		"nested":  "*2\r\n*1\r\n+x\r\n-ERR inner\r\n",
+		"nilarr":  "*-1\r\n",
+	}
+	s := newStandIn(t, func(args []string) string { return replies[args[0]] })
+	client := dialStandIn(t, s)
+
+	tests := []struct {
+		command string
+		want    interface{}
+	}{
+		{"status", "OK"},
+		{"integer", int64(-42)},
+		{"bulk", []byte("hello\r\nworld")},
+		{"empty", []byte{}},
+		{"nil", nil},
+		{"array", []interface{}{[]byte("a"), int64(1), nil}},
+		{"nested", []interface{}{[]interface{}{"x"}, Error("ERR inner")}},
+		{"nilarr", nil},
+	}
+
+	for _, test := range tests {
+		got, err := client.Do(test.command)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.command, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s = %#v, want %#v", test.command, got, test.want)
+		}
+	}
+}
+
+func TestDoSendsArguments(t *testing.T) {
+	received := make(chan []string, 1)
+	s := newStandIn(t, func(args []string) string {
+		received <- args
+		return "+OK\r\n"
+	})
+	client := dialStandIn(t, s)
+
+	want := []string{"SET", "poker:room:a", "line\r\nbreak", ""}
+	if _, err := client.Do(want...); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-received; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+}
+
+func TestDoErrorReplyKeepsConnection(t *testing.T) {
+	s := newStandIn(t, func(args []string) string {
+		if args[0] == "FAIL" {
+			return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+		}
+		return "+PONG\r\n"
+	})
+	client := dialStandIn(t, s)
+
+	_, err := client.Do("FAIL")
+	var replyErr Error
+	if !errors.As(err, &replyErr) || !strings.HasPrefix(string(replyErr), "WRONGTYPE") {
+		t.Fatalf("error = %v, want a WRONGTYPE error reply", err)
+	}
+
+	if reply, err := client.Do("PING"); err != nil || reply != "PONG" {
+		t.Fatalf("PING after an error reply = %v, %v", reply, err)
+	}
+	if got := s.accepted(); got != 1 {
+		t.Errorf("connections = %d, want the first one kept", got)
+	}
+}
+
+func TestDoReconnectsAfterDroppedConnection(t *testing.T) {
+	s := newStandIn(t, func(args []string) string {
+		if args[0] == "DROP" {
+			return ""
+		}
+		return "+PONG\r\n"
+	})
+	client := dialStandIn(t, s)
+
+	if _, err := client.Do("DROP"); err == nil {
+		t.Fatal("command on a dropped connection succeeded")
+	}
+
+	if reply, err := client.Do("PING"); err != nil || reply != "PONG" {
+		t.Fatalf("PING after a dropped connection = %v, %v", reply, err)
+	}
+	if got := s.accepted(); got != 2 {
+		t.Errorf("connections = %d, want a new one", got)
+	}
+}
+
+func TestDialAuthenticates(t *testing.T) {
+	s := newStandIn(t, func(args []string) string {
+		if args[0] == "AUTH" && args[1] != "secret" {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	})
+
+	if _, err := Dial(s.addr(), "wrong"); err == nil {
+		t.Error("Dial succeeded with a wrong password")
+	}
+
+	client, err := Dial(s.addr(), "secret")
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	client.Close()
+}
+
+func TestMalformedReply(t *testing.T) {
+	s := newStandIn(t, func(args []string) string { return "?what\r\n" })
+	client := dialStandIn(t, s)
+
+	if _, err := client.Do("PING"); !errors.Is(err, ErrProtocol) {
+		t.Errorf("error = %v, want ErrProtocol", err)
+	}
+}
+
+func TestSubscriptionReceive(t *testing.T) {
+	s := newStandIn(t, func(args []string) string {
+		return "*3\r\n$10\r\npsubscribe\r\n$14\r\npoker:events:*\r\n:1\r\n" +
+			"*3\r\n$7\r\nmessage\r\n$1\r\nx\r\n$7\r\nignored\r\n" +
+			"*4\r\n$8\r\npmessage\r\n$14\r\npoker:events:*\r\n$14\r\npoker:events:a\r\n$4\r\ndata\r\n"
+	})
+
+	sub, err := PSubscribe(s.addr(), "", "poker:events:*")
+	if err != nil {
+		t.Fatalf("PSubscribe: %v", err)
+	}
+	defer sub.Close()
+
+	channel, payload, err := sub.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if channel != "poker:events:a" || string(payload) != "data" {
+		t.Errorf("Receive = %q, %q, want the pmessage", channel, payload)
+	}
+}
@@ -5,9 +5,15 @@ const state = {
     isCreator: false,
     playerName: '',
     playerID: null,
+    token: null,
     selectedCard: null,
     roomStatus: 'voting',
     websocket: null,
+    websocketFailures: 0,
+    eventSource: null,
+    lastSeq: null,
+    instance: null,
+    reconnectDelay: null,
     sessionStorage: {
         setItem(key, value) {
             try {
@@ -43,8 +49,10 @@ const roomScreen = document.getElementById('room-screen');
 const createRoomForm = document.getElementById('create-room-form');
 const joinRoomForm = document.getElementById('join-room-form');
 const creatorNameInput = document.getElementById('creator-name');
+const deckSelect = document.getElementById('deck-select');
 const playerNameInput = document.getElementById('player-name');
 const roomIdInput = document.getElementById('room-id');
+const joinAsObserverInput = document.getElementById('join-as-observer');
 const roomIdDisplay = document.getElementById('room-id-display');
 const shareRoomBtn = document.getElementById('share-room');
 const leaveRoomBtn = document.getElementById('leave-room');
@@ -52,7 +60,7 @@ const revealCardsBtn = document.getElementById('reveal-cards');
 const statusText = document.getElementById('status-text');
 const creatorControls = document.getElementById('creator-controls');
 const playersContainer = document.getElementById('players-container');
-const cardButtons = document.querySelectorAll('.card-btn');
+const cardsContainer = document.querySelector('#card-selection .cards');
 const notification = document.getElementById('notification');
 const historyPanel = document.getElementById('history-panel');
 const toggleHistoryBtn = document.getElementById('toggle-history');
@@ -90,7 +98,7 @@ leaveRoomBtn.addEventListener('click', leaveRoom);
 revealCardsBtn.addEventListener('click', toggleVoting);
 toggleHistoryBtn.addEventListener('click', toggleHistoryPanel);
 closeHistoryBtn.addEventListener('click', closeHistoryPanel);
-cardButtons.forEach(button => {
+document.querySelectorAll('.card-btn').forEach(button => {
     button.addEventListener('click', () => {
         selectCard(button.dataset.value);
     });
@@ -116,13 +124,22 @@ document.addEventListener('DOMContentLoaded', () => {
 window.addEventListener('beforeunload', () => {
     if (state.currentRoom && state.playerID) {
         // Try to leave the room gracefully
-        fetch(`/api/rooms/${state.currentRoom}/leave?playerID=${encodeURIComponent(state.playerID)}`, {
+        fetch(`/api/rooms/${state.currentRoom}/leave`, {
             method: 'GET',
+            headers: authHeaders(),
             keepalive: true
         });
     }
 });
 
+// Build request headers carrying the player's session token
+function authHeaders(headers = {}) {
+    if (state.token) {
+        headers['X-Session-Token'] = state.token;
+    }
+    return headers;
+}
+
 // API Functions
 async function createRoom(e) {
     e.preventDefault();
@@ -139,7 +156,7 @@ async function createRoom(e) {
             headers: {
                 'Content-Type': 'application/json'
             },
-            body: JSON.stringify({ name })
+            body: JSON.stringify({ name, deck: deckSelect.value })
         });
         
         const responseData = await response.json();
@@ -158,6 +175,7 @@ async function createRoom(e) {
         // Get player ID from response
         if (data.playerID) {
             state.playerID = data.playerID;
+            state.token = data.token;
         } else {
             console.error("Server did not return a player ID for the creator");
             throw new Error("No player ID received from server");
@@ -198,7 +216,10 @@ async function joinRoom(e) {
             headers: {
                 'Content-Type': 'application/json'
             },
-            body: JSON.stringify({ name })
+            body: JSON.stringify({
+                name,
+                role: joinAsObserverInput.checked ? 'observer' : 'voter'
+            })
         });
         
         const responseData = await response.json();
@@ -214,6 +235,7 @@ async function joinRoom(e) {
         state.currentRoom = roomId;
         state.playerName = name;
         state.playerID = data.playerID; // Store the player ID from the server
+        state.token = data.token;
         state.isCreator = false;
         
         // Enter the room
@@ -228,7 +250,9 @@ async function leaveRoom() {
     if (!state.currentRoom || !state.playerID) return;
     
     try {
-        const response = await fetch(`/api/rooms/${state.currentRoom}/leave?playerID=${encodeURIComponent(state.playerID)}`);
+        const response = await fetch(`/api/rooms/${state.currentRoom}/leave`, {
+            headers: authHeaders()
+        });
         
         // Even if the request fails, reset the app state
         resetState();
@@ -261,11 +285,10 @@ async function selectCard(cardValue) {
     try {
         const response = await fetch(`/api/rooms/${state.currentRoom}/vote`, {
             method: 'POST',
-            headers: {
+            headers: authHeaders({
                 'Content-Type': 'application/json'
-            },
+            }),
             body: JSON.stringify({
-                playerID: state.playerID,
                 card: cardValue
             })
         });
@@ -290,7 +313,9 @@ async function toggleVoting() {
     try {
         if (state.roomStatus === 'voting') {
             // Reveal cards
-            const response = await fetch(`/api/rooms/${state.currentRoom}/reveal?playerID=${encodeURIComponent(state.playerID)}`);
+            const response = await fetch(`/api/rooms/${state.currentRoom}/reveal`, {
+                headers: authHeaders()
+            });
             
             if (!response.ok) {
                 const data = await response.json();
@@ -302,7 +327,9 @@ async function toggleVoting() {
             
         } else {
             // Reset voting
-            const response = await fetch(`/api/rooms/${state.currentRoom}/reset?playerID=${encodeURIComponent(state.playerID)}`);
+            const response = await fetch(`/api/rooms/${state.currentRoom}/reset`, {
+                headers: authHeaders()
+            });
             
             if (!response.ok) {
                 const data = await response.json();
@@ -326,11 +353,11 @@ async function toggleVoting() {
                 
                 // Explicitly clear the link in the database
                 try {
-                    await fetch(`/api/rooms/${state.currentRoom}?playerID=${encodeURIComponent(state.playerID)}`, {
+                    await fetch(`/api/rooms/${state.currentRoom}`, {
                         method: 'PATCH',
-                        headers: {
+                        headers: authHeaders({
                             'Content-Type': 'application/json'
-                        },
+                        }),
                         body: JSON.stringify({ link: '' })
                     });
                     
@@ -352,11 +379,11 @@ async function updateSessionLink() {
     const link = sessionLinkInput.value.trim();
     
     try {
-        const response = await fetch(`/api/rooms/${state.currentRoom}?playerID=${encodeURIComponent(state.playerID)}`, {
+        const response = await fetch(`/api/rooms/${state.currentRoom}`, {
             method: 'PATCH',
-            headers: {
+            headers: authHeaders({
                 'Content-Type': 'application/json'
-            },
+            }),
             body: JSON.stringify({ link })
         });
         
@@ -382,6 +409,7 @@ function enterRoom() {
     state.sessionStorage.setItem(`poker_player_${state.currentRoom}`, state.playerName);
     if (state.playerID) {
         state.sessionStorage.setItem(`poker_playerID_${state.currentRoom}`, state.playerID);
+        state.sessionStorage.setItem(`poker_token_${state.currentRoom}`, state.token);
         if (state.isCreator) {
             state.sessionStorage.setItem(`poker_isCreator_${state.currentRoom}`, 'true');
         } else {
@@ -407,12 +435,18 @@ function enterRoom() {
     
     // Connect to websocket only if we have a player ID
     if (state.playerID) {
+        state.lastSeq = null;
         connectWebSocket();
     } else {
         console.error("Cannot connect to WebSocket: no player ID available");
     }
 }
 
+// Sequence numbers are specific to the server instance that sent them
+function eventCursor() {
+    return state.instance ? `${state.instance}:${state.lastSeq}` : `${state.lastSeq}`;
+}
+
 function connectWebSocket() {
     // Close any existing connection
     if (state.websocket) {
@@ -422,14 +456,23 @@ function connectWebSocket() {
     
     // Create connection URL with appropriate protocol
     const protocol = window.location.protocol === 'https:' ? 'wss://' : 'ws://';
-    const url = `${protocol}${window.location.host}/api/rooms/${state.currentRoom}/ws?playerID=${encodeURIComponent(state.playerID)}`;
+    // The session cookie authenticates the connection, keeping the token out of the URL
+    let url = `${protocol}${window.location.host}/api/rooms/${state.currentRoom}/ws`;
+    
+    // Ask for the events missed while disconnected
+    if (state.lastSeq !== null) {
+        url += `?since=${encodeURIComponent(eventCursor())}`;
+    }
     
     try {
         // Create new WebSocket connection
         state.websocket = new WebSocket(url);
         
         // Set up event handlers
-        state.websocket.onopen = () => console.log('WebSocket connection established');
+        state.websocket.onopen = () => {
+            console.log('WebSocket connection established');
+            state.websocketFailures = 0;
+        };
         state.websocket.onmessage = handleRoomEvent;
         state.websocket.onerror = handleWebSocketError;
         state.websocket.onclose = handleWebSocketClose;
@@ -443,18 +486,60 @@ function handleWebSocketError(error) {
     console.error('WebSocket error:', error);
 }
 
-function handleWebSocketClose() {
-    console.log('WebSocket connection closed');
+function handleWebSocketClose(event) {
+    console.log('WebSocket connection closed', event.code, event.reason);
+    
+    // The server dropped us for falling behind, catch up right away
+    if (event.code === 4008) {
+        connectWebSocket();
+        return;
+    }
+    
+    // We were removed from the room, do not come back
+    if (event.code === 4003) {
+        return;
+    }
+    
+    // The server is restarting, reconnect once it is back
+    if (event.code === 1012) {
+        scheduleReconnect(state.reconnectDelay || 5000);
+        state.reconnectDelay = null;
+        return;
+    }
+    
+    // Some proxies break WebSockets, fall back to Server-Sent Events
+    state.websocketFailures++;
+    if (state.websocketFailures >= 3 && state.currentRoom && state.playerID) {
+        connectEventSource();
+        return;
+    }
+    
     scheduleReconnect();
 }
 
-function scheduleReconnect() {
+function connectEventSource() {
+    if (state.eventSource) {
+        state.eventSource.close();
+    }
+    
+    let url = `/api/rooms/${state.currentRoom}/events`;
+    if (state.lastSeq !== null) {
+        url += `?since=${encodeURIComponent(eventCursor())}`;
+    }
+    
+    // The browser reconnects by itself, resuming from the last event ID
+    state.eventSource = new EventSource(url);
+    state.eventSource.onopen = () => console.log('Event stream established');
+    state.eventSource.onmessage = handleRoomEvent;
+}
+
+function scheduleReconnect(delay = 5000) {
     // Attempt to reconnect after a delay
     setTimeout(() => {
         if (state.currentRoom && state.playerID) {
             connectWebSocket();
         }
-    }, 5000); // 5 second delay before reconnecting
+    }, delay); // 5 second delay before reconnecting by default
 }
 
 function handleRoomEvent(event) {
@@ -462,13 +547,47 @@ function handleRoomEvent(event) {
         const data = JSON.parse(event.data);
         console.log('Received event:', data.type);
         
+        // Events are numbered per room, except transient ones like timer ticks
+        if (data.type === 'initial_state') {
+            state.lastSeq = data.seq || 0;
+            state.instance = data.payload.instance || null;
+        } else if (data.seq) {
+            if (state.lastSeq !== null && data.seq <= state.lastSeq) {
+                // Already covered by the room state we have
+                return;
+            }
+            if (state.lastSeq !== null && data.seq > state.lastSeq + 1) {
+                // Some events were lost, resync the whole room
+                state.lastSeq = data.seq;
+                fetchRoomState();
+                
+                // The server makes room for its shutdown notice by dropping
+                // older events, the notice still says when to reconnect
+                if (data.type !== 'server_shutdown') {
+                    return;
+                }
+            }
+            state.lastSeq = data.seq;
+        }
+        
         // Call the appropriate event handler based on event type
         const handlers = {
             'initial_state': handleInitialState,
+            'room_synced': handleInitialState,
+            'room_expiring': handleRoomExpiring,
+            'room_expired': handleRoomExpired,
+            'room_closed': handleRoomClosed,
+            'player_kicked': handlePlayerKicked,
+            'server_shutdown': handleServerShutdown,
             'player_joined': handlePlayerJoined,
             'player_left': handlePlayerLeft,
             'vote_submitted': handleVoteSubmitted,
             'cards_revealed': handleCardsRevealed,
+            'cards_auto_revealed': handleCardsAutoRevealed,
+            'auto_reveal_scheduled': handleAutoRevealScheduled,
+            'auto_reveal_cancelled': handleAutoRevealCancelled,
+            'timer_started': handleTimerStarted,
+            'timer_tick': handleTimerTick,
             'voting_reset': handleVotingReset,
             'link_updated': handleLinkUpdated,
             'creator_changed': handleCreatorChanged,
@@ -492,6 +611,47 @@ function handleInitialState(payload) {
     updateRoomState(payload);
 }
 
+function handleRoomExpiring(payload) {
+    const minutes = Math.max(1, Math.round((new Date(payload.expiresAt) - Date.now()) / 60000));
+    const reason = payload.reason === 'idle' ? 'due to inactivity' : 'as it reached its maximum lifetime';
+    showNotification(`This room will close in ${minutes} minute(s) ${reason}`, true);
+}
+
+function handleRoomExpired(payload) {
+    showNotification('This room has closed', true);
+    exitRoom();
+}
+
+function handleRoomClosed(payload) {
+    showNotification(`This room has closed: ${payload.reason}`, true);
+    exitRoom();
+}
+
+function handlePlayerKicked(payload) {
+    // Other players are told when the player leaves
+    if (payload.id !== state.playerID) {
+        return;
+    }
+    
+    showNotification('You were removed from the room', true);
+    exitRoom();
+}
+
+// The server disconnects us, go back to the home screen
+function exitRoom() {
+    resetState();
+    homeScreen.classList.remove('hidden');
+    roomScreen.classList.add('hidden');
+    history.pushState({}, '', '/');
+}
+
+function handleServerShutdown(payload) {
+    showNotification('The server is restarting, reconnecting shortly...');
+    
+    // Spread reconnections so the restarted server is not flooded
+    state.reconnectDelay = (payload.reconnectAfter || 5) * 1000 * (1 + Math.random());
+}
+
 function handlePlayerJoined(payload) {
     showNotification(`${payload.name} joined the room`);
     fetchRoomState();
@@ -512,6 +672,30 @@ function handleCardsRevealed(payload) {
     updateRoomState(payload);
 }
 
+function handleCardsAutoRevealed(payload) {
+    showNotification('Everyone has voted, cards revealed!');
+    updateRoomState(payload);
+}
+
+function handleAutoRevealScheduled(payload) {
+    const seconds = Math.max(1, Math.round((new Date(payload.revealAt) - Date.now()) / 1000));
+    showNotification(`Everyone has voted, revealing cards in ${seconds} seconds`);
+}
+
+function handleAutoRevealCancelled(payload) {
+    showNotification('Automatic reveal cancelled');
+}
+
+function handleTimerStarted(payload) {
+    showNotification(`Timer started: ${payload.duration} seconds to vote`);
+}
+
+function handleTimerTick(payload) {
+    if (state.roomStatus === 'voting') {
+        statusText.textContent = `Voting in progress... ${payload.remaining}s left`;
+    }
+}
+
 function handleVotingReset(payload) {
     showNotification('Voting has been reset');
     
@@ -545,7 +729,7 @@ function handleCreatorTransferred(payload) {
     document.querySelectorAll('.context-menu').forEach(menu => menu.remove());
     
     // Immediately fetch the room state to get the updated creator information
-    fetch(`/api/rooms/${state.currentRoom}?playerID=${encodeURIComponent(state.playerID)}`)
+    fetch(`/api/rooms/${state.currentRoom}`, { headers: authHeaders() })
         .then(response => {
             if (!response.ok) {
                 throw new Error('Failed to fetch room state');
@@ -588,9 +772,13 @@ function updateRoomState(room) {
     // Update reveal button text based on status
     revealCardsBtn.textContent = room.status === 'voting' ? 'Reveal Cards' : 'Restart Voting';
     
+    // Render the cards of the room's deck
+    renderDeck(room.deck);
+    
     // Enable/disable card selection based on room status
     const cardSelectionSection = document.getElementById('card-selection');
-    if (room.status === 'revealed') {
+    const me = room.players[state.playerID];
+    if (room.status === 'revealed' || (me && me.role === 'observer')) {
         cardSelectionSection.classList.add('disabled');
     } else {
         cardSelectionSection.classList.remove('disabled');
@@ -691,6 +879,14 @@ function renderPlayers(room) {
         const playerName = document.createElement('div');
         playerName.className = 'player-name';
         playerName.textContent = player.id === state.playerID ? `${player.name} (You)` : player.name;
+        if (player.role === 'observer') {
+            playerName.textContent += ' 👁';
+            playerCard.classList.add('observer');
+        }
+        if (player.presence === 'away') {
+            playerCard.classList.add('away');
+            playerCard.title = 'Disconnected';
+        }
         
         const pokerCard = document.createElement('div');
         pokerCard.className = 'poker-card';
@@ -1041,8 +1237,30 @@ function renderVoteHistory(room) {
     });
 }
 
+// Render the card buttons of the room's deck
+function renderDeck(deck) {
+    if (!deck || !deck.cards) return;
+    
+    // Only rebuild the buttons when the deck changes
+    const values = deck.cards.map(card => card.value).join('|');
+    if (cardsContainer.dataset.deck === values) return;
+    cardsContainer.dataset.deck = values;
+    
+    cardsContainer.innerHTML = '';
+    deck.cards.forEach(card => {
+        const button = document.createElement('button');
+        button.className = 'card-btn';
+        button.dataset.value = card.value;
+        button.textContent = card.label || (card.value === 'coffee' ? '☕' : card.value);
+        button.addEventListener('click', () => selectCard(card.value));
+        cardsContainer.appendChild(button);
+    });
+    
+    updateCardSelection();
+}
+
 function updateCardSelection() {
-    cardButtons.forEach(btn => {
+    document.querySelectorAll('.card-btn').forEach(btn => {
         if (btn.dataset.value === state.selectedCard) {
             btn.classList.add('selected');
         } else {
@@ -1068,6 +1286,7 @@ function resetState() {
     state.isCreator = false;
     state.playerName = '';
     state.playerID = null;
+    state.token = null;
     state.selectedCard = null;
     state.roomStatus = 'voting';
     
@@ -1076,6 +1295,11 @@ function resetState() {
         state.websocket.close();
         state.websocket = null;
     }
+    if (state.eventSource) {
+        state.eventSource.close();
+        state.eventSource = null;
+    }
+    state.websocketFailures = 0;
     
     // Reset UI elements
     playersContainer.innerHTML = '';
@@ -1083,7 +1307,7 @@ function resetState() {
     historyPanel.classList.add('hidden');
     
     // Reset selected cards
-    cardButtons.forEach(card => card.classList.remove('selected'));
+    document.querySelectorAll('.card-btn').forEach(card => card.classList.remove('selected'));
     
     // Hide creator controls
     creatorControls.classList.add('hidden');
@@ -1122,17 +1346,19 @@ function checkForRoomInURL() {
         // Check if we have this room ID and name in local storage
         const savedPlayerName = state.sessionStorage.getItem(`poker_player_${roomId}`);
         const savedPlayerID = state.sessionStorage.getItem(`poker_playerID_${roomId}`);
+        const savedToken = state.sessionStorage.getItem(`poker_token_${roomId}`);
         const isCreator = state.sessionStorage.getItem(`poker_isCreator_${roomId}`) === 'true';
         
-        if (savedPlayerName && savedPlayerID) {
+        if (savedPlayerName && savedPlayerID && savedToken) {
             // Auto-join with saved credentials
             state.currentRoom = roomId;
             state.playerName = savedPlayerName;
             state.playerID = savedPlayerID;
+            state.token = savedToken;
             state.isCreator = isCreator;
             
             // Get the room state
-            fetch(`/api/rooms/${roomId}?playerID=${encodeURIComponent(savedPlayerID)}`)
+            fetch(`/api/rooms/${roomId}`, { headers: authHeaders() })
                 .then(response => {
                     if (!response.ok) {
                         throw new Error('Failed to rejoin room');
@@ -1215,6 +1441,7 @@ async function rejoinRoom(roomId, playerName) {
         // Save the player ID we got from the server
         if (data.playerID) {
             state.playerID = data.playerID;
+            state.token = data.token;
             
             // Successfully rejoined, enter the room
             enterRoom();
@@ -1280,7 +1507,7 @@ function fallbackCopyToClipboard(text) {
 function fetchRoomState() {
     if (!state.currentRoom || !state.playerID) return;
     
-    fetch(`/api/rooms/${state.currentRoom}?playerID=${encodeURIComponent(state.playerID)}`)
+    fetch(`/api/rooms/${state.currentRoom}`, { headers: authHeaders() })
         .then(response => {
             if (!response.ok) {
                 throw new Error('Failed to fetch room state');
@@ -1304,11 +1531,11 @@ async function transferCreatorRole(newCreatorID) {
         state.isCreator = false;
         creatorControls.classList.add('hidden');
         
-        const response = await fetch(`/api/rooms/${state.currentRoom}/transfer-creator?playerID=${encodeURIComponent(state.playerID)}`, {
+        const response = await fetch(`/api/rooms/${state.currentRoom}/transfer-creator`, {
             method: 'POST',
-            headers: {
+            headers: authHeaders({
                 'Content-Type': 'application/json'
-            },
+            }),
             body: JSON.stringify({ newCreatorID })
         });
         